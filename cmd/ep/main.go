@@ -25,6 +25,7 @@
 
 	"github.com/cgi-fr/emporte-piece/internal/infra"
 	"github.com/cgi-fr/emporte-piece/pkg/filetree"
+	"github.com/cgi-fr/emporte-piece/pkg/jsonpath"
 	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -44,10 +45,26 @@
 	debug     bool
 	colormode string
 
-	outputDir string
-	format    string
+	opts options
 )
 
+// options are the flags of the generation.
+type options struct {
+	outputDir  string
+	format     string
+	strict     bool
+	dialect    string
+	separators string
+	names      string
+	collisions string
+	delims     string
+	nameDelims string
+	raw        []string
+	suffix     string
+	dotNames   bool
+	ignore     []string
+}
+
 func main() {
 	cobra.OnInitialize(initLog)
 
@@ -66,7 +83,7 @@ func main() {
 		},
 		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := run(cmd, args[0], outputDir, format); err != nil {
+			if err := run(cmd, args[0], opts); err != nil {
 				log.Fatal().Err(err).Msg("end")
 			}
 		},
@@ -81,9 +98,29 @@ func main() {
 	rootCmd.PersistentFlags().BoolVar(&jsonlog, "log-json", false, "output logs in JSON format")
 	rootCmd.PersistentFlags().StringVar(&colormode, "color", "auto", "use colors in log outputs : yes, no or auto")
 
-	rootCmd.PersistentFlags().StringVarP(&outputDir, "output", "o", ".", "output directory")
+	rootCmd.PersistentFlags().StringVarP(&opts.outputDir, "output", "o", ".", "output directory")
+	rootCmd.PersistentFlags().
+		StringVarP(&opts.format, "format", "f", "yaml", "format of context data : yaml, json or jsonl (default=yaml)")
+	rootCmd.PersistentFlags().BoolVar(&opts.strict, "strict", false, "fail on missing context keys instead of generating empty values")
 	rootCmd.PersistentFlags().
-		StringVarP(&format, "format", "f", "yaml", "format of context data : yaml, json or jsonl (default=yaml)")
+		StringVar(&opts.dialect, "dialect", "emporte-piece", "syntax of path expressions : emporte-piece or rfc9535")
+	rootCmd.PersistentFlags().StringVar(&opts.separators, "separators", "reject",
+		"names developed with a path separator : reject, replace (with _) or allow (create subdirectories)")
+	rootCmd.PersistentFlags().StringVar(&opts.names, "names", "keep",
+		"names not valid on every platform : keep, error, replace (with _) or transliterate (remove accents and replace)")
+	rootCmd.PersistentFlags().StringVar(&opts.collisions, "collisions", "error",
+		"targets generated twice, or differing only by case : error, warn or ignore")
+	rootCmd.PersistentFlags().StringVar(&opts.delims, "delims", "{{ }}",
+		"left and right delimiters of the file contents, separated by a space (a file can override them with ep:delims)")
+	rootCmd.PersistentFlags().StringVar(&opts.nameDelims, "name-delims", "{{ }}",
+		"left and right delimiters of the path expressions in file names, separated by a space")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.raw, "raw", nil,
+		"glob patterns of the files copied verbatim, binary files and files ending with .raw are always copied")
+	rootCmd.PersistentFlags().StringVar(&opts.suffix, "suffix", "", "suffix removed from the names of the template files (.tmpl)")
+	rootCmd.PersistentFlags().BoolVar(&opts.dotNames, "dot-names", false,
+		"generate dot-files from the names starting with _dot_ or dot. (_dot_gitignore or dot.gitignore)")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.ignore, "ignore", nil,
+		"gitignore-style patterns of the template entries not generated, before the patterns of the .epignore file")
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Err(err).Msg("error when executing command")
@@ -91,10 +128,15 @@ func main() {
 	}
 }
 
-func run(_ *cobra.Command, templateDir, outputDir, format string) error {
+func run(cmd *cobra.Command, templateDir string, opts options) error {
 	var contextReader infra.ContextReader
 
-	switch strings.ToLower(format) {
+	driver, err := newDriver(cmd, opts)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(opts.format) {
 	case "yaml", "yml":
 		contextReader = infra.NewContextReaderYAML(os.Stdin)
 	case "json":
@@ -109,9 +151,7 @@ func run(_ *cobra.Command, templateDir, outputDir, format string) error {
 			return fmt.Errorf("%w", err)
 		}
 
-		driver := filetree.NewDriver(infra.FileSystem{})
-
-		err = driver.Develop(templateDir, outputDir, context)
+		err = driver.Develop(templateDir, opts.outputDir, context)
 		if err != nil {
 			return fmt.Errorf("%w", err)
 		}
@@ -120,6 +160,81 @@ func run(_ *cobra.Command, templateDir, outputDir, format string) error {
 	return nil
 }
 
+// newDriver builds the driver from the flags. The generation options are set only by the flags set on the command
+// line, the other ones are left to the template manifest.
+//
+//nolint:cyclop
+func newDriver(cmd *cobra.Command, opts options) (filetree.Driver, error) {
+	dialect, err := jsonpath.ParseDialect(opts.dialect)
+	if err != nil {
+		return filetree.Driver{}, fmt.Errorf("%w", err)
+	}
+
+	separators, err := filetree.ParseSeparatorPolicy(opts.separators)
+	if err != nil {
+		return filetree.Driver{}, fmt.Errorf("%w", err)
+	}
+
+	names, err := filetree.ParseNamePolicy(opts.names)
+	if err != nil {
+		return filetree.Driver{}, fmt.Errorf("%w", err)
+	}
+
+	collisions, err := filetree.ParseCollisionPolicy(opts.collisions)
+	if err != nil {
+		return filetree.Driver{}, fmt.Errorf("%w", err)
+	}
+
+	left, right, err := filetree.ParseDelims(opts.delims)
+	if err != nil {
+		return filetree.Driver{}, fmt.Errorf("%w", err)
+	}
+
+	nameLeft, nameRight, err := filetree.ParseDelims(opts.nameDelims)
+	if err != nil {
+		return filetree.Driver{}, fmt.Errorf("%w", err)
+	}
+
+	driver := filetree.NewDriver(infra.FileSystem{}).
+		WithStrict(opts.strict).
+		WithSeparators(separators).
+		WithNames(names).
+		WithCollisions(collisions).
+		WithVersion(version)
+
+	flags := cmd.Flags()
+
+	if flags.Changed("dialect") {
+		driver = driver.WithDialect(dialect)
+	}
+
+	if flags.Changed("delims") {
+		driver = driver.WithDelims(left, right)
+	}
+
+	if flags.Changed("name-delims") {
+		driver = driver.WithNameDelims(nameLeft, nameRight)
+	}
+
+	if flags.Changed("raw") {
+		driver = driver.WithRaw(opts.raw...)
+	}
+
+	if flags.Changed("suffix") {
+		driver = driver.WithSuffix(opts.suffix)
+	}
+
+	if flags.Changed("dot-names") {
+		driver = driver.WithDotNames(opts.dotNames)
+	}
+
+	if flags.Changed("ignore") {
+		driver = driver.WithIgnore(opts.ignore...)
+	}
+
+	return driver, nil
+}
+
 func initLog() {
 	color := false
 
@@ -3,6 +3,7 @@ module github.com/cgi-fr/emporte-piece
 go 1.21
 
 require (
+	github.com/Masterminds/semver/v3 v3.2.0
 	github.com/Masterminds/sprig/v3 v3.2.3
 	github.com/alediaferia/prefixmap v1.0.1
 	github.com/mattn/go-isatty v0.0.14
@@ -15,7 +16,6 @@ require (
 
 require (
 	github.com/Masterminds/goutils v1.1.1 // indirect
-	github.com/Masterminds/semver/v3 v3.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/google/uuid v1.1.1 // indirect
 	github.com/huandu/xstrings v1.3.3 // indirect
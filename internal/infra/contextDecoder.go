@@ -0,0 +1,182 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package infra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cgi-fr/emporte-piece/pkg/jsonpath"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnexpectedToken = errors.New("unexpected token")
+
+// decodeYAML converts a YAML node to a context value, objects are decoded as ordered maps to keep the document order.
+func decodeYAML(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+
+		return decodeYAML(node.Content[0])
+	case yaml.AliasNode:
+		return decodeYAML(node.Alias)
+	case yaml.SequenceNode:
+		array := make([]any, 0, len(node.Content))
+
+		for _, child := range node.Content {
+			value, err := decodeYAML(child)
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, value)
+		}
+
+		return array, nil
+	case yaml.MappingNode:
+		return decodeYAMLMapping(node)
+	default:
+		var value any
+
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+
+		return value, nil
+	}
+}
+
+func decodeYAMLMapping(node *yaml.Node) (*jsonpath.OrderedMap, error) {
+	result := jsonpath.NewOrderedMap()
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+
+		if keyNode.Tag == "!!merge" {
+			if err := mergeYAML(result, valueNode); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		value, err := decodeYAML(valueNode)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Set(keyNode.Value, value)
+	}
+
+	return result, nil
+}
+
+// mergeYAML handles the merge key (<<), merged entries never override explicit keys.
+func mergeYAML(result *jsonpath.OrderedMap, node *yaml.Node) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	sources := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		sources = node.Content
+	}
+
+	for _, source := range sources {
+		value, err := decodeYAML(source)
+		if err != nil {
+			return err
+		}
+
+		merged, ok := value.(*jsonpath.OrderedMap)
+		if !ok {
+			return fmt.Errorf("%w: merge key expects a mapping", ErrUnexpectedToken)
+		}
+
+		for _, key := range merged.Keys() {
+			if _, exists := result.Get(key); !exists {
+				mergedValue, _ := merged.Get(key)
+				result.Set(key, mergedValue)
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeJSON reads the next JSON value of the decoder, objects are decoded as ordered maps to keep the document order.
+func decodeJSON(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		result := jsonpath.NewOrderedMap()
+
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, fmt.Errorf("%w", err)
+			}
+
+			key, ok := keyToken.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: %v", ErrUnexpectedToken, keyToken)
+			}
+
+			value, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			result.Set(key, value)
+		}
+
+		_, err = decoder.Token()
+
+		return result, err //nolint:wrapcheck
+	case '[':
+		result := []any{}
+
+		for decoder.More() {
+			value, err := decodeJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, value)
+		}
+
+		_, err = decoder.Token()
+
+		return result, err //nolint:wrapcheck
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedToken, delim)
+	}
+}
@@ -51,14 +51,10 @@ func (cr *ContextReaderJSON) Next() (any, error) {
 		return nil, ErrContextReaderEmpty
 	}
 
-	bytes, err := io.ReadAll(cr.input)
-	if err != nil {
-		return nil, fmt.Errorf("error reading JSON input: %w", err)
-	}
+	cr.read = true
 
-	context := make(map[string]any)
-
-	if err := json.Unmarshal(bytes, &context); err != nil {
+	context, err := decodeJSON(json.NewDecoder(cr.input))
+	if err != nil {
 		return nil, fmt.Errorf("error parsing JSON input: %w", err)
 	}
 
@@ -19,6 +19,7 @@
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -65,9 +66,8 @@ func (cr *ContextReaderJSONL) Next() (any, error) {
 		return nil, cr.err
 	}
 
-	context := make(map[string]any)
-
-	if err := json.Unmarshal(cr.value, &context); err != nil {
+	context, err := decodeJSON(json.NewDecoder(bytes.NewReader(cr.value)))
+	if err != nil {
 		return nil, fmt.Errorf("error parsing JSON input: %w", err)
 	}
 
@@ -56,13 +56,18 @@ func (cr *ContextReaderYAML) Next() (any, error) {
 
 	bytes, err := io.ReadAll(cr.input)
 	if err != nil {
-		return nil, fmt.Errorf("error reading JSON input: %w", err)
+		return nil, fmt.Errorf("error reading YAML input: %w", err)
 	}
 
-	context := make(map[string]any)
+	node := &yaml.Node{}
 
-	if err := yaml.Unmarshal(bytes, &context); err != nil {
-		return nil, fmt.Errorf("error parsing JSON input: %w", err)
+	if err := yaml.Unmarshal(bytes, node); err != nil {
+		return nil, fmt.Errorf("error parsing YAML input: %w", err)
+	}
+
+	context, err := decodeYAML(node)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing YAML input: %w", err)
 	}
 
 	return context, nil
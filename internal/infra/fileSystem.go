@@ -20,6 +20,7 @@
 import (
 	"io/fs"
 	"os"
+	"path/filepath"
 )
 
 type FileSystem struct{}
@@ -39,3 +40,14 @@ func (fsys FileSystem) Mkdir(name string, perm fs.FileMode) error {
 func (fsys FileSystem) Open(name string) (fs.File, error) {
 	return os.Open(name) //nolint:wrapcheck
 }
+
+func (fsys FileSystem) EvalSymlinks(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+
+	return filepath.ToSlash(resolved), err //nolint:wrapcheck
+}
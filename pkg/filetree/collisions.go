@@ -0,0 +1,157 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cgi-fr/emporte-piece/pkg/jsonpath"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/text/cases"
+)
+
+// ErrCollision is returned when two developments produce the same target.
+var ErrCollision = errors.New("target collision")
+
+// CollisionPolicy tells what to do when two developments produce the same file, or two targets that differ only
+// by case and would be the same on a case-insensitive file system.
+type CollisionPolicy int
+
+const (
+	// CollisionError fails the generation, it is the default.
+	CollisionError CollisionPolicy = iota
+	// CollisionWarn logs a warning and generates the target again.
+	CollisionWarn
+	// CollisionIgnore generates the target again without a warning.
+	CollisionIgnore
+)
+
+// ParseCollisionPolicy returns the policy with a name: error, warn or ignore.
+func ParseCollisionPolicy(name string) (CollisionPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "error":
+		return CollisionError, nil
+	case "warn":
+		return CollisionWarn, nil
+	case "ignore":
+		return CollisionIgnore, nil
+	default:
+		return CollisionError, fmt.Errorf("%w %s", ErrUnknownPolicy, name)
+	}
+}
+
+// origin is the template entry and the development that produced a target.
+type origin struct {
+	target      string
+	template    string
+	devpath     jsonpath.ResultString
+	isDir       bool
+	static      bool // the name of the template entry has no path expression
+	development int  // number of the development of the driver, one per record of a context stream
+}
+
+func (o origin) String() string {
+	keys := make([]string, len(o.devpath.Loops))
+	for i, loop := range o.devpath.Loops {
+		keys[i] = fmt.Sprint(loop.Key)
+	}
+
+	value := any(nil)
+	if len(o.devpath.Stack) > 0 {
+		value = o.devpath.Stack[len(o.devpath.Stack)-1]
+	}
+
+	return fmt.Sprintf("%s from %s (value %v, keys [%s])", o.target, o.template, value, strings.Join(keys, " "))
+}
+
+// targets records the targets generated by the developments of a driver and its copies, so that the records of a
+// context stream cannot overwrite each other. A directory can be generated several times, the entries of every
+// development are merged in it, but not with a different case.
+type targets struct {
+	exact       map[string]origin
+	folded      map[string]origin
+	development int
+}
+
+func newTargets() *targets {
+	return &targets{
+		exact:       map[string]origin{},
+		folded:      map[string]origin{},
+		development: 0,
+	}
+}
+
+// again tells if a target is generated again by the same static template entry in a later development,
+// like a README.md generated with every record of a context stream.
+func (o origin) again(current origin) bool {
+	return current.static && o.template == current.template && o.development != current.development
+}
+
+// record registers a target and returns an error if it collides with a previous one.
+func (t *targets) record(current origin) error {
+	if previous, exists := t.exact[current.target]; exists && (!previous.isDir || !current.isDir) && !previous.again(current) {
+		return fmt.Errorf("%w: %s and %s", ErrCollision, previous, current)
+	}
+
+	folded := cases.Fold().String(current.target)
+
+	if previous, exists := t.folded[folded]; exists && previous.target != current.target {
+		return fmt.Errorf("%w: %s and %s differ only by case", ErrCollision, previous, current)
+	}
+
+	t.exact[current.target] = current
+	t.folded[folded] = current
+
+	return nil
+}
+
+// checkCollision records a target, a collision is an error or a warning depending on the policy of the driver.
+func (d Driver) checkCollision(target string, template string, devpath jsonpath.ResultString, isDir bool) error {
+	if d.targets == nil || d.collisions == CollisionIgnore {
+		return nil
+	}
+
+	err := d.targets.record(origin{
+		target:      target,
+		template:    template,
+		devpath:     devpath,
+		isDir:       isDir,
+		static:      d.isStatic(path.Base(template)),
+		development: d.targets.development,
+	})
+	if err != nil && d.collisions == CollisionWarn {
+		log.Warn().Err(err).Msg("generating " + target + " again")
+
+		return nil
+	}
+
+	return err
+}
+
+// isStatic tells if the name of a template entry has no path expression and is not a template name.
+func (d Driver) isStatic(name string) bool {
+	left := d.nameLeft
+	if left == "" {
+		left = jsonpath.DefaultLeftDelim
+	}
+
+	return !strings.HasPrefix(name, TemplateNamePrefix) && !strings.Contains(name, left)
+}
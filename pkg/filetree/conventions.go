@@ -0,0 +1,52 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import "strings"
+
+// DotPrefixes start the names of template entries generating dot-files (_dot_gitignore, dot.env),
+// so that they do not act on the template repository itself.
+var DotPrefixes = []string{"_dot_", "dot."} //nolint:gochecknoglobals
+
+// conventionName applies the naming conventions to the name of a template entry, before it is developed:
+// the raw suffix and the template suffix of files are removed, then a dot prefix is replaced with a dot.
+func (d Driver) conventionName(name string, isDir bool) string {
+	if !isDir {
+		name = trimSuffix(name, RawSuffix)
+		name = trimSuffix(name, d.suffix)
+	}
+
+	if d.dotNames {
+		for _, prefix := range DotPrefixes {
+			if len(name) > len(prefix) && strings.HasPrefix(name, prefix) {
+				return "." + strings.TrimPrefix(name, prefix)
+			}
+		}
+	}
+
+	return name
+}
+
+// trimSuffix removes a suffix from a name, unless the name would become empty.
+func trimSuffix(name string, suffix string) string {
+	if suffix == "" || name == suffix {
+		return name
+	}
+
+	return strings.TrimSuffix(name, suffix)
+}
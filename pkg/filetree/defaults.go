@@ -44,7 +44,22 @@ func (fsys *InMemoryFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
 		name += string(os.PathSeparator)
 	}
 
-	for _, item := range fsys.disk.GetByPrefix(name) {
+	items := []any{}
+
+	if path.Clean(name) == "." {
+		// the entries of the current directory have no prefix
+		name = ""
+
+		fsys.disk.EachPrefix(func(prefix prefixmap.Prefix) (bool, bool) {
+			items = append(items, prefix.Values...)
+
+			return false, false
+		})
+	} else {
+		items = fsys.disk.GetByPrefix(name)
+	}
+
+	for _, item := range items {
 		file := item.(*File) //nolint:forcetypeassert
 		if strings.Count(strings.TrimPrefix(file.path, name), string(os.PathSeparator)) == 0 {
 			result = append(result, file)
@@ -70,7 +85,9 @@ func (fsys *InMemoryFileSystem) WriteFile(name string, data []byte, perm fs.File
 			}
 		}
 	} else {
+		// like os.WriteFile, an existing file is truncated
 		file = files[0].(*File) //nolint:forcetypeassert
+		file.content.Reset()
 	}
 
 	if _, err := file.Write(data); err != nil {
@@ -105,6 +122,8 @@ func (fsys *InMemoryFileSystem) Mkdir(name string, perm fs.FileMode) error {
 	return nil
 }
 
+// Open returns a copy of the file, like os.Open each opened file has its own read offset:
+// a template file developed several times is read from the beginning every time.
 func (fsys *InMemoryFileSystem) Open(name string) (fs.File, error) {
 	var file *File
 
@@ -115,5 +134,8 @@ func (fsys *InMemoryFileSystem) Open(name string) (fs.File, error) {
 
 	file = files[0].(*File) //nolint:forcetypeassert
 
-	return file, nil
+	opened := NewFile(file.path, file.isDir, file.mode)
+	opened.content.Write(file.content.Bytes())
+
+	return opened, nil
 }
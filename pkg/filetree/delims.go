@@ -0,0 +1,60 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DelimsDirective on the first line of a template file overrides the delimiters of its content, the line is removed
+// (# ep:delims [[ ]]). The delimiters are separated by spaces, the rest of the line is free for a comment syntax.
+const DelimsDirective = "ep:delims"
+
+// ErrInvalidDelims is returned when delimiters are not a pair of non-empty strings.
+var ErrInvalidDelims = errors.New("invalid delimiters")
+
+var delimsDirective = regexp.MustCompile(`^[^\n]*` + DelimsDirective + `[ \t]+(\S+)[ \t]+(\S+)[^\n]*\n?`)
+
+// ParseDelims returns the left and the right delimiters separated by a space ("[[ ]]"),
+// an empty string is the default delimiters.
+func ParseDelims(delims string) (string, string, error) {
+	fields := strings.Fields(delims)
+
+	switch len(fields) {
+	case 0:
+		return "", "", nil
+	case 2: //nolint:gomnd
+		return fields[0], fields[1], nil
+	default:
+		return "", "", fmt.Errorf("%w %q", ErrInvalidDelims, delims)
+	}
+}
+
+// fileDelims returns the delimiters of a template file, its own ones if it starts with the delims directive
+// (then the content is returned without the directive line), or the delimiters of the tree.
+func (d Driver) fileDelims(content string) (string, string, string) {
+	match := delimsDirective.FindStringSubmatch(content)
+	if match == nil {
+		return d.left, d.right, content
+	}
+
+	return match[1], match[2], content[len(match[0]):]
+}
@@ -25,3 +25,10 @@ type FileSystem interface {
 	Mkdir(name string, perm fs.FileMode) error
 	Open(name string) (fs.File, error)
 }
+
+// SymlinkResolver is implemented by the file systems with symbolic links, the developed targets are then checked to
+// be inside of the output directory once their links are resolved.
+type SymlinkResolver interface {
+	// EvalSymlinks returns the absolute path of an existing entry, without symbolic links.
+	EvalSymlinks(name string) (string, error)
+}
@@ -22,33 +22,270 @@
 	"io"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/cgi-fr/emporte-piece/pkg/jsonpath"
 	"github.com/cgi-fr/emporte-piece/pkg/template"
 	"github.com/rs/zerolog/log"
 )
 
+// TemplateNamePrefix marks the names rendered with text/template instead of path expressions.
+const TemplateNamePrefix = "="
+
 type Driver struct {
-	fs FileSystem
+	fs           FileSystem
+	developer    jsonpath.Developer
+	generator    template.Generator
+	separators   SeparatorPolicy
+	names        NamePolicy
+	collisions   CollisionPolicy
+	left         string // delimiters of the contents
+	right        string
+	nameLeft     string // delimiters of the names
+	nameRight    string
+	raw          []string     // patterns of the files copied verbatim
+	suffix       string       // suffix removed from the names of the files
+	dotNames     bool         // replace the dot prefixes with a dot
+	ignored      []string     // patterns of the template entries not generated, before the ignore file
+	version      string       // version of ep, checked against the requirements of the manifests
+	explicit     option       // options set with the With methods, the manifests do not override them
+	root         string       // output directory of the current development
+	templateRoot string       // template directory of the current development
+	ignore       []ignoreRule // ignore rules of the current development
+	targets      *targets     // targets generated by the developments of the driver and its copies
 }
 
 func NewDriver(fsys FileSystem) Driver {
 	return Driver{
-		fs: fsys,
+		fs:           fsys,
+		developer:    jsonpath.NewDeveloper().WithFuncs(template.FuncMap()),
+		generator:    template.NewGenerator(),
+		separators:   SeparatorReject,
+		names:        NameKeep,
+		collisions:   CollisionError,
+		left:         "",
+		right:        "",
+		nameLeft:     "",
+		nameRight:    "",
+		raw:          nil,
+		suffix:       "",
+		dotNames:     false,
+		ignored:      nil,
+		version:      "",
+		explicit:     0,
+		root:         "",
+		templateRoot: "",
+		ignore:       nil,
+		targets:      newTargets(),
 	}
 }
 
+// WithStrict returns a copy of the driver that fails on missing keys, in names and in templates.
+func (d Driver) WithStrict(strict bool) Driver {
+	d.developer = d.developer.WithStrict(strict)
+	d.generator = d.generator.WithStrict(strict)
+
+	return d
+}
+
+// WithDialect returns a copy of the driver that parses path expressions in a dialect, in names and in templates.
+func (d Driver) WithDialect(dialect jsonpath.Dialect) Driver {
+	d.developer = d.developer.WithDialect(dialect)
+	d.generator = d.generator.WithDialect(dialect)
+	d.explicit |= optionDialect
+
+	return d
+}
+
+// WithSeparators returns a copy of the driver that handles the developed names containing a path separator
+// with a policy, by default they are rejected.
+func (d Driver) WithSeparators(policy SeparatorPolicy) Driver {
+	d.separators = policy
+
+	return d
+}
+
+// WithNames returns a copy of the driver that checks or fixes the developed names that are not valid on every
+// platform with a policy, by default they are kept as developed.
+func (d Driver) WithNames(policy NamePolicy) Driver {
+	d.names = policy
+
+	return d
+}
+
+// WithCollisions returns a copy of the driver that handles the developments producing the same target with a policy,
+// by default they are an error.
+func (d Driver) WithCollisions(policy CollisionPolicy) Driver {
+	d.collisions = policy
+
+	return d
+}
+
+// WithDelims returns a copy of the driver that renders the contents with other action delimiters ([[ .name ]]),
+// a file can override them with the delims directive. Empty delimiters are the default ones.
+func (d Driver) WithDelims(left string, right string) Driver {
+	d.left, d.right = left, right
+	d.explicit |= optionDelims
+
+	return d
+}
+
+// WithNameDelims returns a copy of the driver that finds the path expressions of the names, and the actions of the
+// template names, between other delimiters (<<tables.[].name>>). Empty delimiters are the default ones.
+func (d Driver) WithNameDelims(left string, right string) Driver {
+	d.nameLeft, d.nameRight = left, right
+	d.explicit |= optionNameDelims
+	d.developer = d.developer.WithDelims(left, right)
+
+	return d
+}
+
+// WithRaw returns a copy of the driver that copies verbatim the template files matching one of the glob patterns
+// (*.png, .mvn/wrapper/*.jar), their names are still developed. Binary files and files ending with .raw are always
+// copied verbatim.
+func (d Driver) WithRaw(patterns ...string) Driver {
+	d.raw = append([]string{}, patterns...)
+	d.explicit |= optionRaw
+
+	return d
+}
+
+// WithSuffix returns a copy of the driver that removes a suffix from the names of the template files (.tmpl),
+// so that main.go.tmpl generates main.go.
+func (d Driver) WithSuffix(suffix string) Driver {
+	d.suffix = suffix
+	d.explicit |= optionSuffix
+
+	return d
+}
+
+// WithDotNames returns a copy of the driver that generates dot-files from the names starting with one of the
+// DotPrefixes (_dot_gitignore and dot.gitignore generate .gitignore), it is disabled by default.
+func (d Driver) WithDotNames(enabled bool) Driver {
+	d.dotNames = enabled
+	d.explicit |= optionDotNames
+
+	return d
+}
+
+// WithIgnore returns a copy of the driver that does not generate the template entries matching gitignore-style
+// patterns, the patterns of the .epignore file of the template root are evaluated after them.
+func (d Driver) WithIgnore(patterns ...string) Driver {
+	d.ignored = append([]string{}, patterns...)
+	d.explicit |= optionIgnore
+
+	return d
+}
+
+// WithVersion returns a copy of the driver that checks a version of ep against the requirements of the template
+// manifests, a version that is not a semantic version satisfies every requirement.
+func (d Driver) WithVersion(version string) Driver {
+	d.version = version
+
+	return d
+}
+
+// Develop generates the template tree in the target directory, every developed entry is checked to be inside of it.
+// The manifest of the template root (ep.yml) sets the options not set explicitly and checks the contexts,
+// the partials of the _partials directory at the root of the template tree are available in every template,
+// the entries matching the patterns of the .epignore file of the root are not generated.
+// The targets of the previous developments of the driver are checked for collisions, except the files with a static
+// name generated again by the same template entry (a README.md generated for every record), build a new driver to
+// start over.
 func (d Driver) Develop(templatePath string, targetPath string, contexts ...any) error {
+	d.root = path.Clean(targetPath)
+	d.templateRoot = path.Clean(templatePath)
+
+	if d.targets != nil {
+		d.targets.development++
+	}
+
+	d, manifest, err := d.loadManifest(templatePath)
+	if err != nil {
+		return err
+	}
+
+	if err := checkRawPatterns(d.raw); err != nil {
+		return err
+	}
+
+	ignore, err := d.ignoreRules(templatePath)
+	if err != nil {
+		return err
+	}
+
+	d.ignore = ignore
+
+	// the Go values of the contexts are converted once, not for every generated file
+	contexts = append([]any{}, contexts...)
+	for i, context := range contexts {
+		if contexts[i], err = jsonpath.Normalize(context); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	if manifest != nil && len(contexts) > 0 {
+		context, err := manifest.applyParameters(contexts[0])
+		if err != nil {
+			return err
+		}
+
+		contexts = append([]any{context}, contexts[1:]...)
+	}
+
+	if d.hasPartials(templatePath) {
+		partials, err := d.loadPartials(templatePath, PartialsDir)
+		if err != nil {
+			return err
+		}
+
+		d.generator = d.generator.WithPartials(partials...)
+	}
+
+	return d.develop(templatePath, targetPath, jsonpath.Scope{Stack: contexts, Vars: nil, Loops: nil})
+}
+
+func (d Driver) develop(templatePath string, targetPath string, scope jsonpath.Scope) error {
 	files, _ := d.fs.ReadDir(templatePath)
 	for _, file := range files {
-		rs, err := jsonpath.Develop(file.Name(), contexts...)
+		subTemplatePath := path.Join(templatePath, file.Name())
+
+		if file.IsDir() && d.isPartialsDir(templatePath, file.Name()) {
+			continue
+		}
+
+		if d.isIgnored(subTemplatePath, file.IsDir()) {
+			log.Debug().Str("from", subTemplatePath).Msg("skipping ignored entry")
+
+			continue
+		}
+
+		rs, err := d.developName(d.conventionName(file.Name(), file.IsDir()), scope)
 		if err != nil {
-			return fmt.Errorf("%w", err)
+			return fmt.Errorf("%s: %w", subTemplatePath, err)
 		}
 
 		for _, devpath := range rs {
-			subTemplatePath := path.Join(templatePath, file.Name())
-			subTargetPath := path.Join(targetPath, devpath.Selected)
+			if devpath.Selected == "" {
+				log.Debug().Str("from", subTemplatePath).Msg("skipping empty name")
+
+				continue
+			}
+
+			subTargetPath, err := d.targetPath(targetPath, devpath.Selected)
+			if err != nil {
+				return fmt.Errorf("%s: %w", subTemplatePath, err)
+			}
+
+			if err := d.checkCollision(subTargetPath, subTemplatePath, devpath, file.IsDir()); err != nil {
+				return err
+			}
+
+			if d.separators == SeparatorAllow && path.Dir(subTargetPath) != path.Clean(targetPath) {
+				if err := d.mkdirParents(subTargetPath); err != nil {
+					return err
+				}
+			}
 
 			log.Info().Str("from", subTemplatePath).Msg("generating " + subTargetPath)
 
@@ -67,20 +304,68 @@ func (d Driver) Develop(templatePath string, targetPath string, contexts ...any)
 	return nil
 }
 
+// relativePath returns the path of a template entry relative to the template root.
+func (d Driver) relativePath(templatePath string) string {
+	templatePath = path.Clean(templatePath)
+	if d.templateRoot == "." {
+		return templatePath
+	}
+
+	return strings.TrimPrefix(strings.TrimPrefix(templatePath, d.templateRoot), "/")
+}
+
+// developName develops the path expressions of a name, or renders it with text/template
+// if it starts with the template prefix (={{if .docker}}Dockerfile{{end}}).
+func (d Driver) developName(name string, scope jsonpath.Scope) ([]jsonpath.ResultString, error) {
+	if !strings.HasPrefix(name, TemplateNamePrefix) {
+		return d.developer.Develop(name, scope) //nolint:wrapcheck
+	}
+
+	generator := d.generator.WithDelims(d.nameLeft, d.nameRight)
+
+	rendered, err := generator.Generate(strings.TrimPrefix(name, TemplateNamePrefix), scope)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return []jsonpath.ResultString{
+		{
+			Selected: strings.TrimSpace(string(rendered)),
+			Stack:    scope.Stack,
+			Vars:     scope.Vars,
+			Loops:    scope.Loops,
+		},
+	}, nil
+}
+
 func (d Driver) developFile(subTargetPath string, subTemplatePath string, devpath jsonpath.ResultString) error {
 	tmplFile, err := d.fs.Open(subTemplatePath)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
+	defer tmplFile.Close()
+
 	tmplContent, err := io.ReadAll(tmplFile)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	content, err := template.Generate(string(tmplContent), devpath.Stack)
+	if d.isRaw(subTemplatePath) || isBinary(tmplContent) {
+		log.Debug().Str("from", subTemplatePath).Msg("copying verbatim")
+
+		if err := d.fs.WriteFile(subTargetPath, tmplContent, os.ModePerm); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		return nil
+	}
+
+	left, right, source := d.fileDelims(string(tmplContent))
+
+	content, err := d.generator.WithDelims(left, right).Generate(source, devpath.Scope())
 	if err != nil {
-		return fmt.Errorf("%w", err)
+		return fmt.Errorf("%s: %w", subTemplatePath, err)
 	}
 
 	if err := d.fs.WriteFile(subTargetPath, content, os.ModePerm); err != nil {
@@ -93,7 +378,7 @@ func (d Driver) developFile(subTargetPath string, subTemplatePath string, devpat
 func (d Driver) developDir(subTargetPath string, subTemplatePath string, devpath jsonpath.ResultString) error {
 	if err := d.fs.Mkdir(subTargetPath, os.ModePerm); err != nil && !os.IsExist(err) {
 		return fmt.Errorf("%w", err)
-	} else if err := d.Develop(subTemplatePath, subTargetPath, devpath.Stack...); err != nil {
+	} else if err := d.develop(subTemplatePath, subTargetPath, devpath.Scope()); err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
@@ -20,9 +20,13 @@
 import (
 	"io"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
+	"github.com/cgi-fr/emporte-piece/internal/infra"
 	"github.com/cgi-fr/emporte-piece/pkg/filetree"
+	"github.com/cgi-fr/emporte-piece/pkg/jsonpath"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
@@ -165,3 +169,918 @@ func TestStack(t *testing.T) {
 	fileM3b, _ := io.ReadAll(fileM3)
 	assert.Equal(t, "[map[nom:Auberge Bressane] map[nom:Mets et Vins] map[nom:Place Bernard]]", string(fileM3b))
 }
+
+func TestGetFunc(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	content := `{{Get "tables.[0].name"}} {{GetAll "tables.[1:].name"}} {{Get "$[-2].name"}}`
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{tables.[-1].name}}.txt", []byte(content), os.ModePerm))
+
+	context := map[string]any{
+		"tables": []any{
+			map[string]any{"name": "first"},
+			map[string]any{"name": "second"},
+			map[string]any{"name": "last"},
+		},
+	}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	f, err := fsys.Open("result/last.txt")
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "first [second last] last", string(b))
+}
+
+func TestRecursiveDescent(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	content := `{{$table := Stack -4}}{{$table.name}}.{{Stack -1}}`
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{..columns.[].name}}.txt", []byte(content), os.ModePerm))
+
+	context := map[string]any{
+		"schemas": []any{
+			map[string]any{
+				"tables": []any{
+					map[string]any{"name": "customer", "columns": []any{map[string]any{"name": "id"}}},
+				},
+			},
+		},
+		"tables": []any{
+			map[string]any{"name": "product", "columns": []any{map[string]any{"name": "label"}}},
+		},
+	}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	for name, expected := range map[string]string{"result/id.txt": "customer.id", "result/label.txt": "product.label"} {
+		f, err := fsys.Open(name)
+		assert.NoError(t, err)
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+
+		assert.Equal(t, expected, string(b))
+	}
+}
+
+func TestQuotedKeys(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	content := `{{Get "$[-2].labels['app.kubernetes.io/name']"}}`
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile(`template/{{apps.[?(@.['app.kubernetes.io\u002fpart-of']=='ep')].['app.name']}}.yml`, []byte(content), os.ModePerm))
+
+	context := map[string]any{
+		"apps": []any{
+			map[string]any{
+				"app.name":                  "api",
+				"app.kubernetes.io/part-of": "ep",
+				"labels":                    map[string]any{"app.kubernetes.io/name": "emporte-piece-api"},
+			},
+			map[string]any{
+				"app.name":                  "db",
+				"app.kubernetes.io/part-of": "other",
+			},
+		},
+	}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	f, err := fsys.Open("result/api.yml")
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "emporte-piece-api", string(b))
+
+	_, err = fsys.Open("result/db.yml")
+	assert.Error(t, err)
+}
+
+func TestAlias(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	content := `{{.table.name}}.{{(Var "col").name}} {{Get "table.columns.[0].name"}} {{.project}}`
+
+	assert.NoError(t, fsys.Mkdir("template/{{tables.[].name as table}}", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{tables.[].name as table}}/{{table.columns.[].name as col}}.txt", []byte(content), os.ModePerm))
+
+	context := map[string]any{
+		"project": "ep",
+		"tables": []any{
+			map[string]any{"name": "customer", "columns": []any{map[string]any{"name": "id"}, map[string]any{"name": "email"}}},
+		},
+	}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	f, err := fsys.Open("result/customer/email.txt")
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "customer.email id ep", string(b))
+}
+
+func TestLoops(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	content := `{{with Loop -1}}{{.Number}}/{{.Count}}{{if .First}} first{{end}}{{if .Last}} last{{end}}{{end}}`
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{@number%02d}}_{{scripts.[]}}.sql", []byte(content), os.ModePerm))
+
+	context := map[string]any{"scripts": []any{"init", "tables"}}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	for name, expected := range map[string]string{"result/01_init.sql": "1/2 first", "result/02_tables.sql": "2/2 last"} {
+		f, err := fsys.Open(name)
+		assert.NoError(t, err)
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+
+		assert.Equal(t, expected, string(b))
+	}
+}
+
+func TestPipes(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{tables.[].name | ToLower | kebabcase}}.yml", []byte(`{{Stack -1}}`), os.ModePerm))
+
+	context := map[string]any{"tables": []any{map[string]any{"name": "CUSTOMER_ORDER"}}}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	f, err := fsys.Open("result/customer-order.yml")
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "CUSTOMER_ORDER", string(b))
+}
+
+func TestTemplateNames(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile(`template/={{if .docker}}Dockerfile{{end}}`, []byte(`FROM {{.image}}`), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile(`template/={{if .ci}}.gitlab-ci.yml{{end}}`, []byte(`stages: []`), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile(`template/={{printf "%s-%s" .name (.version | replace "." "_") | lower}}.txt`, []byte(`{{.name}}`), os.ModePerm))
+	assert.NoError(t, fsys.Mkdir(`template/={{ $n := len .tables }}{{ if gt $n 1 }}tables{{ end }}`, os.ModePerm))
+	assert.NoError(t, fsys.WriteFile(`template/={{ $n := len .tables }}{{ if gt $n 1 }}tables{{ end }}/{{tables.[]}}.sql`, []byte(`{{Stack -1}}`), os.ModePerm))
+
+	context := map[string]any{"docker": true, "ci": false, "image": "alpine", "name": "EP", "version": "1.2", "tables": []any{"a", "b"}}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	for name, expected := range map[string]string{"result/Dockerfile": "FROM alpine", "result/ep-1_2.txt": "EP", "result/tables/b.sql": "b"} {
+		f, err := fsys.Open(name)
+		assert.NoError(t, err)
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+
+		assert.Equal(t, expected, string(b))
+	}
+
+	_, err := fsys.Open("result/.gitlab-ci.yml")
+	assert.Error(t, err)
+}
+
+func TestConditional(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{?features.docker}}Dockerfile", []byte(`FROM {{(Stack -1).image}}`), os.ModePerm))
+	assert.NoError(t, fsys.Mkdir("template/{{?features.ci}}ci", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{?features.ci}}ci/build.yml", []byte(`build`), os.ModePerm))
+
+	context := map[string]any{"features": map[string]any{"docker": map[string]any{"image": "alpine"}, "ci": false}}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	f, err := fsys.Open("result/Dockerfile")
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "FROM alpine", string(b))
+
+	_, err = fsys.Open("result/ci/build.yml")
+	assert.Error(t, err)
+}
+
+func TestStrict(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile(`template/{{name ?: "unnamed"}}.txt`, []byte(`{{.version}}`), os.ModePerm))
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", map[string]any{}))
+
+	f, err := fsys.Open("result/unnamed.txt")
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "<no value>", string(b))
+
+	err = driver.WithStrict(true).Develop("template", "strict", map[string]any{})
+
+	assert.ErrorContains(t, err, `template/{{name ?: "unnamed"}}.txt`)
+	assert.ErrorContains(t, err, `map has no entry for key "version"`)
+
+	assert.NoError(t, fsys.Mkdir("template/{{tables.[].name}}", os.ModePerm))
+
+	err = driver.WithStrict(true).Develop("template", "strict", map[string]any{"version": 1, "tables": []any{map[string]any{}}})
+
+	assert.ErrorIs(t, err, jsonpath.ErrMissingKey)
+	assert.ErrorContains(t, err, "template/{{tables.[].name}}: missing key name in tables.[].name")
+}
+
+func TestTypedContext(t *testing.T) {
+	t.Parallel()
+
+	type table struct {
+		Name    string   `json:"name"`
+		Columns []string `json:"columns"`
+	}
+
+	type schema struct {
+		Owner  string   `yaml:"owner"`
+		Tables []*table `json:"tables"`
+	}
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.Mkdir("template", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{tables.[].name}}.sql",
+		[]byte(`{{(Stack -2).name}}: {{join ", " (Stack -2).columns}}`), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{tables.[].name as table}}.txt",
+		[]byte(`{{.owner}}.{{.table.name}} {{len .tables}}`), os.ModePerm))
+
+	context := schema{Owner: "sales", Tables: []*table{{Name: "customer", Columns: []string{"id", "name"}}}}
+
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	for name, content := range map[string]string{
+		"result/customer.sql": "customer: id, name",
+		"result/customer.txt": "sales.customer 1",
+	} {
+		f, err := fsys.Open(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(b), name)
+	}
+
+	// a context containing itself is an error
+	type parent struct {
+		Name     string           `json:"name"`
+		Children []map[string]any `json:"tables"`
+	}
+
+	cyclic := &parent{Name: "public", Children: nil}
+	cyclic.Children = []map[string]any{{"name": "customer", "schema": cyclic}}
+
+	assert.ErrorIs(t, driver.Develop("template", "cyclic", cyclic), jsonpath.ErrCyclicContext)
+}
+
+func TestDialect(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	content := `{{.table.name}}.{{(Stack -1)}} {{Get "$.tables[?@.name == 'order'].name"}}`
+
+	assert.NoError(t, fsys.Mkdir("template/{{$.tables[?@.masked].name as table}}", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{$.tables[?@.masked].name as table}}/{{table.columns[*].name}}.txt", []byte(content), os.ModePerm))
+
+	context := map[string]any{
+		"tables": []any{
+			map[string]any{"name": "customer", "masked": true, "columns": []any{map[string]any{"name": "id"}, map[string]any{"name": "email"}}},
+			map[string]any{"name": "order", "columns": []any{map[string]any{"name": "id"}}},
+		},
+	}
+
+	driver := filetree.NewDriver(fsys).WithDialect(jsonpath.DialectRFC9535)
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	f, err := fsys.Open("result/customer/email.txt")
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "customer.email order", string(b))
+
+	_, err = fsys.Open("result/order")
+	assert.Error(t, err)
+}
+
+func TestManifestDialect(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.WriteFile("rfc/ep.yml", []byte("options:\n  dialect: rfc9535\n"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("rfc/{{$.tables[?@.masked].name}}.txt", []byte(`{{Get "$.tables[0].name"}}`), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("ep/{{tables.[?(@.masked)].name}}.txt", []byte(`{{Get "tables.[0].name"}}`), os.ModePerm))
+
+	context := map[string]any{
+		"tables": []any{
+			map[string]any{"name": "customer", "masked": true},
+			map[string]any{"name": "order", "masked": false},
+		},
+	}
+
+	// one driver develops both templates, each one in its own dialect
+	driver := filetree.NewDriver(fsys)
+
+	assert.NoError(t, driver.Develop("rfc", "result/rfc", context))
+	assert.NoError(t, driver.Develop("ep", "result/ep", context))
+
+	for _, name := range []string{"result/rfc/customer.txt", "result/ep/customer.txt"} {
+		f, err := fsys.Open(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, "customer", string(b), name)
+	}
+
+	assert.NoError(t, fsys.WriteFile("invalid/ep.yml", []byte("options:\n  dialect: xpath\n"), os.ModePerm))
+
+	_, err := filetree.ReadManifest(fsys, "invalid")
+	assert.ErrorIs(t, err, jsonpath.ErrUnknownDialect)
+}
+
+func TestUnsafeNames(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.Mkdir("template/{{schema}}", os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{schema}}/{{tables.[].name}}.sql", []byte(`{{.schema}}`), os.ModePerm))
+
+	for _, name := range []string{"../../etc/cron.d/x", "/etc/passwd", `..\..\x`, ".."} {
+		err := filetree.NewDriver(fsys).Develop("template", "unsafe", map[string]any{"schema": name})
+		assert.ErrorIs(t, err, filetree.ErrUnsafePath, name)
+
+		err = filetree.NewDriver(fsys).WithSeparators(filetree.SeparatorAllow).Develop("template", "allowed", map[string]any{"schema": name})
+		assert.ErrorIs(t, err, filetree.ErrUnsafePath, name)
+	}
+
+	context := map[string]any{"schema": "public", "tables": []any{map[string]any{"name": "../x/y"}}}
+
+	assert.NoError(t, filetree.NewDriver(fsys).WithSeparators(filetree.SeparatorReplace).Develop("template", "replaced", context))
+
+	_, err := fsys.Open("replaced/public/.._x_y.sql")
+	assert.NoError(t, err)
+
+	assert.NoError(t, filetree.NewDriver(fsys).WithSeparators(filetree.SeparatorAllow).Develop("template", "allowed", context))
+
+	_, err = fsys.Open("allowed/x/y.sql")
+	assert.NoError(t, err)
+}
+
+func TestSymlinkedTargets(t *testing.T) {
+	t.Parallel()
+
+	fsys := infra.FileSystem{}
+	root := t.TempDir()
+
+	assert.NoError(t, os.MkdirAll(path.Join(root, "template/{{schema}}"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(path.Join(root, "template/{{schema}}/{{tables.[].name}}.sql"), []byte(`{{(Stack -2).name}}`), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(path.Join(root, "outside"), os.ModePerm))
+	assert.NoError(t, os.MkdirAll(path.Join(root, "out"), os.ModePerm))
+	assert.NoError(t, os.Symlink("../outside", path.Join(root, "out/public")))
+
+	context := map[string]any{"schema": "public", "tables": []any{map[string]any{"name": "customer"}}}
+
+	err := filetree.NewDriver(fsys).Develop(path.Join(root, "template"), path.Join(root, "out"), context)
+	assert.ErrorIs(t, err, filetree.ErrUnsafePath)
+
+	context["schema"] = "public/sales"
+
+	err = filetree.NewDriver(fsys).WithSeparators(filetree.SeparatorAllow).Develop(path.Join(root, "template"), path.Join(root, "out"), context)
+	assert.ErrorIs(t, err, filetree.ErrUnsafePath)
+
+	entries, err := os.ReadDir(path.Join(root, "outside"))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// the output directory itself can be a link
+	assert.NoError(t, os.MkdirAll(path.Join(root, "real"), os.ModePerm))
+	assert.NoError(t, os.Symlink("real", path.Join(root, "linked")))
+
+	context["schema"] = "public"
+
+	assert.NoError(t, filetree.NewDriver(fsys).Develop(path.Join(root, "template"), path.Join(root, "linked"), context))
+
+	content, err := os.ReadFile(path.Join(root, "real/public/customer.sql"))
+	assert.NoError(t, err)
+	assert.Equal(t, "customer", string(content))
+}
+
+func TestPortableNames(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.WriteFile("template/{{tables.[].name}}", []byte(`{{.name}}`), os.ModePerm))
+
+	testdatas := []struct {
+		name           string
+		replaced       string
+		transliterated string
+	}{
+		{"a:b*c?.txt", "a_b_c_.txt", "a_b_c_.txt"},
+		{"Données.", "Données", "Donnees"},
+		{"con.txt", "con_.txt", "con_.txt"},
+		{"NUL", "NUL_", "NUL_"},
+		{strings.Repeat("é", 200) + ".sql", strings.Repeat("é", 125) + ".sql", strings.Repeat("e", 200) + ".sql"},
+	}
+
+	for _, td := range testdatas {
+		context := map[string]any{"tables": []any{map[string]any{"name": td.name}}}
+
+		err := filetree.NewDriver(fsys).WithNames(filetree.NameError).Develop("template", "error", context)
+		assert.ErrorIs(t, err, filetree.ErrNotPortable, td.name)
+
+		assert.NoError(t, filetree.NewDriver(fsys).WithNames(filetree.NameReplace).Develop("template", "replaced", context))
+
+		_, err = fsys.Open("replaced/" + td.replaced)
+		assert.NoError(t, err, td.name)
+
+		assert.NoError(t, filetree.NewDriver(fsys).WithNames(filetree.NameTransliterate).Develop("template", "transliterated", context))
+
+		_, err = fsys.Open("transliterated/" + td.transliterated)
+		assert.NoError(t, err, td.name)
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.WriteFile("template/{{schemas.[]}}/{{$[-3].tables.[].name}}.sql", []byte(`{{.name}}`), os.ModePerm))
+
+	context := map[string]any{"schemas": []any{"public"}, "tables": []any{map[string]any{"name": "customer"}, map[string]any{"name": "customer"}}}
+
+	err := filetree.NewDriver(fsys).Develop("template", "exact", context)
+	assert.ErrorIs(t, err, filetree.ErrCollision)
+	assert.ErrorContains(t, err, "exact/public/customer.sql from template/{{schemas.[]}}/{{$[-3].tables.[].name}}.sql (value customer, keys [0])")
+	assert.ErrorContains(t, err, "(value customer, keys [1])")
+
+	context = map[string]any{"schemas": []any{"public", "PUBLIC"}, "tables": []any{map[string]any{"name": "customer"}}}
+
+	err = filetree.NewDriver(fsys).Develop("template", "folded", context)
+	assert.ErrorIs(t, err, filetree.ErrCollision)
+	assert.ErrorContains(t, err, "differ only by case")
+
+	assert.NoError(t, filetree.NewDriver(fsys).WithCollisions(filetree.CollisionWarn).Develop("template", "warned", context))
+
+	context = map[string]any{"schemas": []any{"public", "public"}, "tables": []any{map[string]any{"name": "customer"}, map[string]any{"name": "order"}}}
+
+	err = filetree.NewDriver(fsys).Develop("template", "merged", context)
+	assert.ErrorIs(t, err, filetree.ErrCollision, "directories are merged, but their files still collide")
+	assert.ErrorContains(t, err, "merged/public/customer.sql")
+
+	assert.NoError(t, fsys.WriteFile("overwrite/{{tables.[].name}}.txt", []byte(`{{(Stack -2).id}}`), os.ModePerm))
+
+	// the targets of every development of a driver are recorded, like the records of a context stream
+	driver := filetree.NewDriver(fsys)
+	assert.NoError(t, driver.Develop("overwrite", "records", map[string]any{"tables": []any{map[string]any{"name": "a"}}}))
+	err = driver.Develop("overwrite", "records", map[string]any{"tables": []any{map[string]any{"name": "a"}}})
+	assert.ErrorIs(t, err, filetree.ErrCollision)
+	assert.ErrorContains(t, err, "records/a.txt")
+
+	// unless a file with a static name is generated again by the same template entry
+	assert.NoError(t, fsys.WriteFile("overwrite/README.md", []byte(`generated`), os.ModePerm))
+	assert.NoError(t, driver.Develop("overwrite", "records", map[string]any{"tables": []any{map[string]any{"name": "b"}}}))
+	assert.NoError(t, driver.Develop("overwrite", "records", map[string]any{"tables": []any{map[string]any{"name": "c"}}}))
+
+	// with the warn and ignore policies, the last development overwrites the target
+
+	context = map[string]any{"tables": []any{map[string]any{"name": "a", "id": 1}, map[string]any{"name": "a", "id": 2}}}
+
+	for _, policy := range []filetree.CollisionPolicy{filetree.CollisionWarn, filetree.CollisionIgnore} {
+		assert.NoError(t, filetree.NewDriver(fsys).WithCollisions(policy).Develop("overwrite", "overwritten", context))
+
+		f, err := fsys.Open("overwritten/a.txt")
+		if assert.NoError(t, err) {
+			b, err := io.ReadAll(f)
+			assert.NoError(t, err)
+			assert.Equal(t, "2", string(b))
+		}
+	}
+}
+
+func TestPartials(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	partial := `{{define "header"}}# {{.}} - generated{{end}}`
+	helpers := `{{define "column"}}{{.name}} {{.type | upper}}{{end}}`
+	content := `{{$table := Stack -2}}{{template "header" $table.name}}
+{{range $table.columns}}{{include "column" . | trim}};{{end}}`
+
+	assert.NoError(t, fsys.WriteFile("template/_partials/header.tmpl", []byte(partial), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/_partials/sql/helpers.tmpl", []byte(helpers), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{tables.[].name}}.sql", []byte(content), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{tables.[].name}}/_partials/readme.txt", []byte(`{{template "header" "readme"}}`), os.ModePerm))
+
+	context := map[string]any{"tables": []any{map[string]any{"name": "customer", "columns": []any{map[string]any{"name": "id", "type": "int"}}}}}
+
+	assert.NoError(t, filetree.NewDriver(fsys).Develop("template", "result", context))
+
+	f, err := fsys.Open("result/customer.sql")
+	assert.NoError(t, err)
+
+	b, err := io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "# customer - generated\nid INT;", string(b))
+
+	_, err = fsys.Open("result/_partials/header.tmpl")
+	assert.Error(t, err, "the partials directory is not generated")
+
+	f, err = fsys.Open("result/customer/_partials/readme.txt")
+	assert.NoError(t, err, "only the partials directory of the root is reserved")
+
+	b, err = io.ReadAll(f)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "# readme - generated", string(b))
+}
+
+func TestDelims(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	chart := `name: [[ .name ]]
+image: {{ .Values.image }}`
+	workflow := `# ep:delims <% %>
+run: echo ${{ matrix.os }} <% .name | upper %> [[ .name ]]`
+	partial := `[[define "owner"]]owner: [[ . ]][[end]]`
+
+	assert.NoError(t, fsys.WriteFile("template/_partials/owner.tmpl", []byte(partial), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/<<name>>/Chart.yaml", []byte(chart+"\n[[template \"owner\" .name]]"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/<<name>>/{{ci}}.yml", []byte(workflow), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/=<<if .docker>>Dockerfile<<end>>", []byte("FROM [[ .name ]]"), os.ModePerm))
+
+	context := map[string]any{"name": "app", "docker": true}
+
+	driver := filetree.NewDriver(fsys).WithDelims("[[", "]]").WithNameDelims("<<", ">>")
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	expected := map[string]string{
+		"result/app/Chart.yaml": "name: app\nimage: {{ .Values.image }}\nowner: app",
+		"result/app/{{ci}}.yml": "run: echo ${{ matrix.os }} APP [[ .name ]]",
+		"result/Dockerfile":     "FROM app",
+	}
+
+	for name, content := range expected {
+		f, err := fsys.Open(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(b), name)
+	}
+
+	_, _, err := filetree.ParseDelims("[[")
+	assert.ErrorIs(t, err, filetree.ErrInvalidDelims)
+}
+
+func TestRaw(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	logo := []byte{0x89, 'P', 'N', 'G', 0x00, '{', '{'}
+	jar := []byte("PK {{ not a template")
+
+	assert.NoError(t, fsys.WriteFile("template/{{name}}.png", logo, os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/.mvn/wrapper/maven-wrapper.jar", jar, os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{name}}.tpl.raw", []byte("{{ .name }}"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{name}}.txt", []byte("{{ .name }}"), os.ModePerm))
+
+	context := map[string]any{"name": "app"}
+
+	assert.NoError(t, filetree.NewDriver(fsys).WithRaw(".mvn/wrapper/*.jar").Develop("template", "result", context))
+
+	expected := map[string]string{
+		"result/app.png":                        string(logo),
+		"result/.mvn/wrapper/maven-wrapper.jar": string(jar),
+		"result/app.tpl":                        "{{ .name }}",
+		"result/app.txt":                        "app",
+	}
+
+	for name, content := range expected {
+		f, err := fsys.Open(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(b), name)
+	}
+
+	err := filetree.NewDriver(fsys).WithRaw("[").Develop("template", "result2", context)
+	assert.Error(t, err)
+
+	// the patterns are relative to a template root of . too
+	fsys = filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.WriteFile(".mvn/wrapper/maven-wrapper.jar", jar, os.ModePerm))
+	assert.NoError(t, filetree.NewDriver(fsys).WithRaw(".mvn/wrapper/*.jar").Develop(".", "result", context))
+
+	f, err := fsys.Open("result/.mvn/wrapper/maven-wrapper.jar")
+	if assert.NoError(t, err) {
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, string(jar), string(b))
+	}
+}
+
+func TestConventionNames(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	assert.NoError(t, fsys.WriteFile("template/{{name}}/main.go.tmpl", []byte("package {{.name}}"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/_dot_gitignore", []byte("/{{.name}}"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/dot.env.tmpl", []byte("NAME={{.name}}"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/_dot_github/workflows/ci.yml.tmpl.raw", []byte("${{ matrix.os }}"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/.tmpl", []byte("kept"), os.ModePerm))
+
+	context := map[string]any{"name": "app"}
+
+	assert.NoError(t, filetree.NewDriver(fsys).WithSuffix(".tmpl").WithDotNames(true).Develop("template", "result", context))
+
+	expected := map[string]string{
+		"result/app/main.go":              "package app",
+		"result/.gitignore":               "/app",
+		"result/.env":                     "NAME=app",
+		"result/.github/workflows/ci.yml": "${{ matrix.os }}",
+		"result/.tmpl":                    "kept",
+	}
+
+	for name, content := range expected {
+		f, err := fsys.Open(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(b), name)
+	}
+
+	assert.NoError(t, filetree.NewDriver(fsys).Develop("template", "result2", context))
+
+	_, err := fsys.Open("result2/_dot_gitignore")
+	assert.NoError(t, err, "dot names are disabled by default")
+}
+
+func TestIgnore(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	ignore := `# documentation of the template
+/README.md
+*.swp
+.git/
+docs/**
+!docs/keep.md
+build/
+\#notes
+_partials/*.md
+`
+
+	files := []string{
+		"template/.epignore",
+		"template/README.md",
+		"template/.git/HEAD",
+		"template/.DS_Store",
+		"template/#notes",
+		"template/{{name}}/README.md",
+		"template/{{name}}/.main.go.swp",
+		"template/{{name}}/main.go",
+		"template/{{name}}/build",
+		"template/docs/guide.md",
+		"template/docs/keep.md",
+		"template/_partials/README.md",
+		"template/_partials/header.tmpl",
+	}
+
+	for _, name := range files {
+		assert.NoError(t, fsys.WriteFile(name, []byte(""), os.ModePerm))
+	}
+
+	assert.NoError(t, fsys.WriteFile("template/.epignore", []byte(ignore), os.ModePerm))
+
+	context := map[string]any{"name": "app"}
+
+	assert.NoError(t, filetree.NewDriver(fsys).WithIgnore(".DS_Store").Develop("template", "result", context))
+
+	for name, generated := range map[string]bool{
+		"result/.epignore":           false,
+		"result/README.md":           false,
+		"result/.git/HEAD":           false,
+		"result/.DS_Store":           false,
+		"result/#notes":              false,
+		"result/app/README.md":       true,
+		"result/app/.main.go.swp":    false,
+		"result/app/main.go":         true,
+		"result/app/build":           true,
+		"result/docs/guide.md":       false,
+		"result/docs/keep.md":        true,
+		"result/_partials/README.md": false,
+	} {
+		_, err := fsys.Open(name)
+		if generated {
+			assert.NoError(t, err, name)
+		} else {
+			assert.Error(t, err, name)
+		}
+	}
+
+	// the template root can be the current directory (cd template && ep -o ../result .)
+	fsys = filetree.NewInMemoryFileSystem()
+
+	for _, name := range []string{".epignore", ".git/HEAD", "README.md"} {
+		assert.NoError(t, fsys.WriteFile(name, []byte(".git/\n"), os.ModePerm))
+	}
+
+	assert.NoError(t, filetree.NewDriver(fsys).Develop(".", "result", context))
+
+	for name, generated := range map[string]bool{
+		"result/.epignore": false,
+		"result/.git/HEAD": false,
+		"result/README.md": true,
+	} {
+		_, err := fsys.Open(name)
+		if generated {
+			assert.NoError(t, err, name)
+		} else {
+			assert.Error(t, err, name)
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	t.Parallel()
+
+	fsys := filetree.NewInMemoryFileSystem()
+
+	manifest := `name: service
+version: 1.0.0
+description: a service
+requires: ">= 0.2.0"
+parameters:
+  - name: name
+    type: string
+    required: true
+  - name: port
+    type: integer
+    default: 8080
+options:
+  delims: "[[ ]]"
+  suffix: .tmpl
+  ignore: [docs/]
+  raw: ["*.svg"]
+`
+
+	assert.NoError(t, fsys.WriteFile("template/ep.yml", []byte(manifest), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/{{name}}.yml.tmpl", []byte("port: [[ .port ]] {{ keep }}"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/logo.svg", []byte("[[ .name ]]"), os.ModePerm))
+	assert.NoError(t, fsys.WriteFile("template/docs/index.md", []byte(""), os.ModePerm))
+
+	m, err := filetree.ReadManifest(fsys, "template")
+	assert.NoError(t, err)
+	assert.Equal(t, "service", m.Name)
+	assert.NoError(t, m.CheckVersion("0.2.1"))
+	assert.NoError(t, m.CheckVersion("dev"))
+	assert.ErrorIs(t, m.CheckVersion("0.1.0"), filetree.ErrIncompatibleVersion)
+
+	driver := filetree.NewDriver(fsys).WithVersion("0.2.1")
+
+	context := jsonpath.NewOrderedMap()
+	context.Set("name", "app")
+
+	assert.NoError(t, driver.Develop("template", "result", context))
+
+	for name, content := range map[string]string{
+		"result/app.yml":  "port: 8080 {{ keep }}",
+		"result/logo.svg": "[[ .name ]]",
+	} {
+		f, err := fsys.Open(name)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		b, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(b), name)
+	}
+
+	_, has := context.Get("port")
+	assert.False(t, has, "the context is not modified")
+
+	for _, name := range []string{"result/ep.yml", "result/docs/index.md"} {
+		_, err := fsys.Open(name)
+		assert.Error(t, err, name)
+	}
+
+	assert.ErrorIs(t, driver.Develop("template", "result2", map[string]any{}), filetree.ErrMissingParameter)
+	assert.ErrorIs(t, driver.Develop("template", "result3", map[string]any{"name": "app", "port": "80"}),
+		filetree.ErrInvalidParameter)
+
+	assert.NoError(t, fsys.WriteFile("invalid/ep.yml", []byte("nmae: typo"), os.ModePerm))
+
+	_, err = filetree.ReadManifest(fsys, "invalid")
+	assert.ErrorIs(t, err, filetree.ErrInvalidManifest)
+
+	m, err = filetree.ReadManifest(fsys, "none")
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	err = filetree.NewDriver(fsys).WithVersion("0.1.0").Develop("template", "result4", context)
+	assert.ErrorIs(t, err, filetree.ErrIncompatibleVersion)
+
+	// an option set explicitly is not overridden by the manifest
+	err = filetree.NewDriver(fsys).WithDelims("{{", "}}").Develop("template", "result5", context)
+	assert.ErrorContains(t, err, `function "keep" not defined`)
+}
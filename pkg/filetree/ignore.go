@@ -0,0 +1,180 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile at the root of a template tree lists gitignore-style patterns of the template entries that are not
+// generated, it is never generated itself.
+const IgnoreFile = ".epignore"
+
+// ignoreRule is a pattern of an ignore file, matched against a template path relative to the template root.
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool // the pattern starts with ! and includes again the entries excluded by a previous rule
+	dirOnly bool // the pattern ends with / and matches only directories
+}
+
+// parseIgnoreRules parses gitignore-style patterns: blank lines and lines starting with # are skipped, a leading !
+// negates the pattern, a trailing / matches only directories, a pattern containing a / is relative to the template
+// root else it matches a name at any depth, * and ? do not match a /, ** matches any number of directories.
+func parseIgnoreRules(lines []string) ([]ignoreRule, error) {
+	rules := []ignoreRule{}
+
+	for _, line := range lines {
+		line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{pattern: nil, negate: false, dirOnly: false}
+
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+
+		if line == "" {
+			continue
+		}
+
+		expression := globToRegexp(line)
+		if !anchored {
+			expression = "(?:.*/)?" + expression
+		}
+
+		pattern, err := regexp.Compile("^" + expression + "$")
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid ignore pattern %q: %w", IgnoreFile, line, err)
+		}
+
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// globToRegexp translates a gitignore glob to a regular expression.
+//
+//nolint:cyclop
+func globToRegexp(glob string) string {
+	result := strings.Builder{}
+
+	for i := 0; i < len(glob); i++ {
+		switch char := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			result.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob) && (i == 0 || glob[i-1] == '/'):
+			result.WriteString(".*")
+			i++
+		case char == '*':
+			result.WriteString("[^/]*")
+		case char == '?':
+			result.WriteString("[^/]")
+		case char == '\\' && i+1 < len(glob):
+			i++
+			result.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case char == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				result.WriteString(`\[`)
+
+				continue
+			}
+
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			result.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			result.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+
+	return result.String()
+}
+
+// ignoreRules parses the ignore patterns of the driver, then the ignore file of the template root.
+func (d Driver) ignoreRules(templatePath string) ([]ignoreRule, error) {
+	rules, err := parseIgnoreRules(d.ignored)
+	if err != nil {
+		return nil, err
+	}
+
+	fileRules, err := d.loadIgnoreRules(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rules, fileRules...), nil
+}
+
+// loadIgnoreRules reads the ignore file of the template root, if any.
+func (d Driver) loadIgnoreRules(templatePath string) ([]ignoreRule, error) {
+	content, err := d.readFile(path.Join(templatePath, IgnoreFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return parseIgnoreRules(strings.Split(string(content), "\n"))
+}
+
+// isIgnored tells if a template entry is excluded from the generation, the last matching rule wins.
+// The entries of an ignored directory are never reached, they cannot be included again.
+func (d Driver) isIgnored(templatePath string, isDir bool) bool {
+	relative := d.relativePath(templatePath)
+	if relative == IgnoreFile || relative == ManifestFile {
+		return true
+	}
+
+	ignored := false
+
+	for _, rule := range d.ignore {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		if rule.pattern.MatchString(relative) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
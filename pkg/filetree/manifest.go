@@ -0,0 +1,375 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/cgi-fr/emporte-piece/pkg/jsonpath"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// ManifestFile at the root of a template tree describes the template, it is never generated.
+const ManifestFile = "ep.yml"
+
+var (
+	// ErrInvalidManifest is returned when the manifest file cannot be parsed.
+	ErrInvalidManifest = errors.New("invalid manifest")
+	// ErrIncompatibleVersion is returned when the version of ep does not satisfy the requirement of a template.
+	ErrIncompatibleVersion = errors.New("incompatible version")
+	// ErrMissingParameter is returned when a required parameter is missing from the context.
+	ErrMissingParameter = errors.New("missing parameter")
+	// ErrInvalidParameter is returned when a parameter of the context does not have the declared type.
+	ErrInvalidParameter = errors.New("invalid parameter")
+)
+
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Manifest describes a template: what it generates, the version of ep it requires,
+// the parameters it expects at the root of the context and its generation options.
+type Manifest struct {
+	Name        string      `yaml:"name"`
+	Version     string      `yaml:"version"`
+	Description string      `yaml:"description"`
+	Requires    string      `yaml:"requires"` // semantic version constraint (>= 0.2.0)
+	Parameters  []Parameter `yaml:"parameters"`
+	Options     Options     `yaml:"options"`
+}
+
+// Parameter is a key expected at the root of the context. A missing or null parameter is replaced with its default
+// value, or is an error if it is required.
+type Parameter struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"` // string, number, integer, boolean, list, object, or any if empty
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+	Default     any    `yaml:"default"`
+}
+
+// Options are the generation options of a template, they replace the options of the driver
+// that were not set explicitly.
+type Options struct {
+	Dialect    string   `yaml:"dialect"`    // syntax of the path expressions: emporte-piece or rfc9535
+	Delims     string   `yaml:"delims"`     // delimiters of the contents, separated by a space ([[ ]])
+	NameDelims string   `yaml:"nameDelims"` // delimiters of the names, separated by a space (<< >>)
+	Suffix     string   `yaml:"suffix"`
+	DotNames   *bool    `yaml:"dotNames"`
+	Ignore     []string `yaml:"ignore"`
+	Raw        []string `yaml:"raw"`
+}
+
+// ReadManifest reads and checks the manifest file of a template root, it returns nil if there is none.
+func ReadManifest(fsys FileSystem, templatePath string) (*Manifest, error) {
+	file, err := fsys.Open(path.Join(templatePath, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil //nolint:nilnil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	manifest := &Manifest{} //nolint:exhaustruct
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(manifest); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidManifest, ManifestFile, err)
+	}
+
+	if err := manifest.check(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidManifest, ManifestFile, err)
+	}
+
+	return manifest, nil
+}
+
+// check returns an error if the requirement, a parameter or an option of the manifest is malformed.
+//
+//nolint:cyclop
+func (m *Manifest) check() error {
+	if m.Requires != "" {
+		if _, err := semver.NewConstraint(m.Requires); err != nil {
+			return fmt.Errorf("requires %q: %w", m.Requires, err)
+		}
+	}
+
+	for _, parameter := range m.Parameters {
+		if !parameterName.MatchString(parameter.Name) {
+			return fmt.Errorf("%w: invalid name %q", ErrInvalidParameter, parameter.Name)
+		}
+
+		if !isParameterType(parameter.Type) {
+			return fmt.Errorf("%w: %s: unknown type %q", ErrInvalidParameter, parameter.Name, parameter.Type)
+		}
+
+		if parameter.Default != nil && !hasType(parameter.Default, parameter.Type) {
+			return fmt.Errorf("%w: %s: default value is not a %s", ErrInvalidParameter, parameter.Name, parameter.Type)
+		}
+	}
+
+	if _, err := jsonpath.ParseDialect(m.Options.Dialect); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if _, _, err := ParseDelims(m.Options.Delims); err != nil {
+		return err
+	}
+
+	if _, _, err := ParseDelims(m.Options.NameDelims); err != nil {
+		return err
+	}
+
+	if _, err := parseIgnoreRules(m.Options.Ignore); err != nil {
+		return err
+	}
+
+	return checkRawPatterns(m.Options.Raw)
+}
+
+// CheckVersion returns an error if a version of ep does not satisfy the requirement of the template.
+// A version that is not a semantic version (a development build) satisfies every requirement.
+func (m *Manifest) CheckVersion(version string) error {
+	if m.Requires == "" {
+		return nil
+	}
+
+	current, err := semver.NewVersion(version)
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	constraint, err := semver.NewConstraint(m.Requires)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+	}
+
+	if !constraint.Check(current) {
+		return fmt.Errorf("%w: %s requires ep %s, this is %s", ErrIncompatibleVersion, m.Name, m.Requires, version)
+	}
+
+	return nil
+}
+
+// option is a generation option of the driver that a manifest can set.
+type option uint
+
+const (
+	optionDelims option = 1 << iota
+	optionNameDelims
+	optionSuffix
+	optionDotNames
+	optionIgnore
+	optionRaw
+	optionDialect
+)
+
+// withManifest returns a copy of the driver with the generation options of a manifest,
+// except the options set explicitly with the With methods of the driver.
+func (d Driver) withManifest(manifest *Manifest) Driver {
+	options := manifest.Options
+	apply := func(opt option, set bool) bool {
+		return set && d.explicit&opt == 0
+	}
+
+	// the options are checked when the manifest is read
+	if apply(optionDialect, options.Dialect != "") {
+		dialect, _ := jsonpath.ParseDialect(options.Dialect)
+		d.developer = d.developer.WithDialect(dialect)
+		d.generator = d.generator.WithDialect(dialect)
+	}
+
+	if apply(optionDelims, options.Delims != "") {
+		d.left, d.right, _ = ParseDelims(options.Delims)
+	}
+
+	if apply(optionNameDelims, options.NameDelims != "") {
+		d.nameLeft, d.nameRight, _ = ParseDelims(options.NameDelims)
+		d.developer = d.developer.WithDelims(d.nameLeft, d.nameRight)
+	}
+
+	if apply(optionSuffix, options.Suffix != "") {
+		d.suffix = options.Suffix
+	}
+
+	if apply(optionDotNames, options.DotNames != nil) {
+		d.dotNames = *options.DotNames
+	}
+
+	if apply(optionIgnore, options.Ignore != nil) {
+		d.ignored = options.Ignore
+	}
+
+	if apply(optionRaw, options.Raw != nil) {
+		d.raw = options.Raw
+	}
+
+	return d
+}
+
+// loadManifest reads the manifest of the template root, checks the version of ep
+// and returns a copy of the driver with its options.
+func (d Driver) loadManifest(templatePath string) (Driver, *Manifest, error) {
+	manifest, err := ReadManifest(d.fs, templatePath)
+	if err != nil || manifest == nil {
+		return d, nil, err
+	}
+
+	log.Info().Str("name", manifest.Name).Str("version", manifest.Version).Msg("template manifest")
+
+	if err := manifest.CheckVersion(d.version); err != nil {
+		return d, nil, err
+	}
+
+	return d.withManifest(manifest), manifest, nil
+}
+
+// applyParameters checks the parameters of the manifest in the root of the context,
+// it returns a copy of the context with the default values of the missing parameters.
+func (m *Manifest) applyParameters(context any) (any, error) {
+	developer := jsonpath.NewDeveloper()
+	defaults := []Parameter{}
+
+	for _, parameter := range m.Parameters {
+		results, err := developer.Get("['"+parameter.Name+"']", jsonpath.Scope{Stack: []any{context}, Vars: nil, Loops: nil})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidParameter, parameter.Name, err)
+		}
+
+		var value any
+		if len(results) > 0 {
+			value = results[0].Selected
+		}
+
+		switch {
+		case value == nil && parameter.Default != nil:
+			defaults = append(defaults, parameter)
+		case value == nil && parameter.Required:
+			return nil, fmt.Errorf("%w: %s", ErrMissingParameter, parameter.Name)
+		case value != nil && !hasType(value, parameter.Type):
+			return nil, fmt.Errorf("%w: %s is not a %s", ErrInvalidParameter, parameter.Name, parameter.Type)
+		}
+	}
+
+	if len(defaults) == 0 {
+		return context, nil
+	}
+
+	return withDefaults(context, defaults)
+}
+
+// withDefaults returns a copy of an object of the context with the default values of parameters,
+// the original is not modified.
+func withDefaults(context any, defaults []Parameter) (any, error) {
+	switch typed := context.(type) {
+	case nil:
+		result := jsonpath.NewOrderedMap()
+		for _, parameter := range defaults {
+			result.Set(parameter.Name, parameter.Default)
+		}
+
+		return result, nil
+	case *jsonpath.OrderedMap:
+		result := jsonpath.NewOrderedMap()
+		for _, key := range typed.Keys() {
+			value, _ := typed.Get(key)
+			result.Set(key, value)
+		}
+
+		for _, parameter := range defaults {
+			result.Set(parameter.Name, parameter.Default)
+		}
+
+		return result, nil
+	case map[string]any:
+		result := make(map[string]any, len(typed)+len(defaults))
+		for key, value := range typed {
+			result[key] = value
+		}
+
+		for _, parameter := range defaults {
+			result[parameter.Name] = parameter.Default
+		}
+
+		return result, nil
+	default:
+		return nil, fmt.Errorf("%w: cannot set default values in a %T", ErrInvalidParameter, context)
+	}
+}
+
+func isParameterType(name string) bool {
+	switch name {
+	case "", "any", "string", "number", "integer", "boolean", "list", "object":
+		return true
+	default:
+		return false
+	}
+}
+
+// hasType tells if a value of the context has a parameter type.
+//
+//nolint:cyclop
+func hasType(value any, name string) bool {
+	if _, ok := value.(*jsonpath.OrderedMap); ok {
+		return name == "" || name == "any" || name == "object"
+	}
+
+	kind := reflect.Indirect(reflect.ValueOf(value)).Kind()
+
+	switch name {
+	case "string":
+		return kind == reflect.String
+	case "boolean":
+		return kind == reflect.Bool
+	case "integer":
+		if kind == reflect.Float32 || kind == reflect.Float64 {
+			number := reflect.Indirect(reflect.ValueOf(value)).Float()
+
+			return number == float64(int64(number))
+		}
+
+		return isIntegerKind(kind)
+	case "number":
+		return isIntegerKind(kind) || kind == reflect.Float32 || kind == reflect.Float64
+	case "list":
+		return kind == reflect.Slice || kind == reflect.Array
+	case "object":
+		return kind == reflect.Map || kind == reflect.Struct
+	default:
+		return true
+	}
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Uint64
+}
@@ -0,0 +1,180 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cgi-fr/emporte-piece/pkg/template"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MaxNameLength is the longest portable name, in bytes.
+	MaxNameLength = 255
+	// MaxPathLength is the longest portable path relative to the output directory, in characters.
+	MaxPathLength = 260
+)
+
+// ErrNotPortable is returned when a developed name is not valid on every platform.
+var ErrNotPortable = errors.New("not portable name")
+
+// reservedName matches the device names reserved on Windows, with or without an extension.
+var reservedName = regexp.MustCompile(`(?i)^(CON|PRN|AUX|NUL|COM[1-9]|LPT[1-9])(\..*)?$`)
+
+// NamePolicy tells what to do with a developed name that is not valid on every platform: a name containing
+// one of the characters <>:"|?* or a control character, ending with a dot or a space, reserved on Windows (CON, NUL)
+// or longer than MaxNameLength bytes.
+type NamePolicy int
+
+const (
+	// NameKeep writes the names as developed, it is the default.
+	NameKeep NamePolicy = iota
+	// NameError fails the generation.
+	NameError
+	// NameReplace replaces the invalid characters with an underscore, removes the trailing dots and spaces,
+	// adds an underscore to reserved names and truncates long names.
+	NameReplace
+	// NameTransliterate removes the accents, then replaces like NameReplace.
+	NameTransliterate
+)
+
+// ParseNamePolicy returns the policy with a name: keep, error, replace or transliterate.
+func ParseNamePolicy(name string) (NamePolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "keep":
+		return NameKeep, nil
+	case "error":
+		return NameError, nil
+	case "replace":
+		return NameReplace, nil
+	case "transliterate":
+		return NameTransliterate, nil
+	default:
+		return NameKeep, fmt.Errorf("%w %s", ErrUnknownPolicy, name)
+	}
+}
+
+// portableName checks or fixes each segment of a developed name, the names . and .. are left to targetPath.
+func (d Driver) portableName(name string) (string, error) {
+	if d.names == NameKeep {
+		return name, nil
+	}
+
+	if d.names == NameTransliterate {
+		name = template.RemoveAccents(name)
+	}
+
+	segments := strings.Split(name, "/")
+
+	for i, segment := range segments {
+		if segment == "." || segment == ".." {
+			continue
+		}
+
+		if problem := nameProblem(segment); problem != "" {
+			if d.names == NameError {
+				return "", fmt.Errorf("%w: %q %s", ErrNotPortable, segment, problem)
+			}
+
+			segments[i] = fixName(segment)
+		}
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// checkPathLength verifies that a target is not too long relative to the output directory, a long path cannot be
+// fixed so it is only a warning with the replace policies.
+func (d Driver) checkPathLength(target string) error {
+	relative := strings.TrimPrefix(target, strings.TrimSuffix(d.root, "/")+"/")
+	if d.names == NameKeep || utf8.RuneCountInString(relative) <= MaxPathLength {
+		return nil
+	}
+
+	if d.names == NameError {
+		return fmt.Errorf("%w: %s is longer than %d characters", ErrNotPortable, relative, MaxPathLength)
+	}
+
+	log.Warn().Str("target", target).Msgf("path longer than %d characters", MaxPathLength)
+
+	return nil
+}
+
+func nameProblem(name string) string {
+	for _, char := range name {
+		if isInvalidChar(char) {
+			return fmt.Sprintf("contains the character %q", char)
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, " "):
+		return "ends with a dot or a space"
+	case reservedName.MatchString(name):
+		return "is a reserved name"
+	case len(name) > MaxNameLength:
+		return fmt.Sprintf("is longer than %d bytes", MaxNameLength)
+	default:
+		return ""
+	}
+}
+
+func isInvalidChar(char rune) bool {
+	return char < ' ' || strings.ContainsRune(`<>:"|?*`, char)
+}
+
+func fixName(name string) string {
+	name = strings.Map(func(char rune) rune {
+		if isInvalidChar(char) {
+			return '_'
+		}
+
+		return char
+	}, name)
+
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		name = "_"
+	}
+
+	if match := reservedName.FindStringSubmatch(name); match != nil {
+		name = match[1] + "_" + match[2]
+	}
+
+	if len(name) > MaxNameLength {
+		ext := path.Ext(name)
+		if len(ext) >= MaxNameLength {
+			ext = ""
+		}
+
+		base := name[:MaxNameLength-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+
+		name = base + ext
+	}
+
+	return name
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import (
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/cgi-fr/emporte-piece/pkg/template"
+)
+
+// PartialsDir is the directory at the root of a template tree holding the partials, it is not generated.
+const PartialsDir = "_partials"
+
+// loadPartials reads the files of the partials directory and its subdirectories, each partial is named
+// after its path relative to the template root (_partials/license.tmpl).
+func (d Driver) loadPartials(templatePath string, dir string) ([]template.Partial, error) {
+	partials := []template.Partial{}
+
+	files, _ := d.fs.ReadDir(path.Join(templatePath, dir))
+	for _, file := range files {
+		name := path.Join(dir, file.Name())
+
+		if d.isIgnored(path.Join(templatePath, name), file.IsDir()) {
+			continue
+		}
+
+		if file.IsDir() {
+			subPartials, err := d.loadPartials(templatePath, name)
+			if err != nil {
+				return nil, err
+			}
+
+			partials = append(partials, subPartials...)
+
+			continue
+		}
+
+		source, err := d.readFile(path.Join(templatePath, name))
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+
+		left, right, content := d.fileDelims(string(source))
+
+		partials = append(partials, template.Partial{Name: name, Source: content, Left: left, Right: right})
+	}
+
+	return partials, nil
+}
+
+// hasPartials tells if the template tree has a partials directory at its root.
+func (d Driver) hasPartials(templatePath string) bool {
+	files, _ := d.fs.ReadDir(templatePath)
+	for _, file := range files {
+		if file.IsDir() && file.Name() == PartialsDir {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPartialsDir tells if an entry of the template tree is the partials directory.
+func (d Driver) isPartialsDir(templatePath string, file string) bool {
+	return path.Clean(templatePath) == d.templateRoot && file == PartialsDir
+}
+
+// readFile returns the content of a file of the template tree.
+func (d Driver) readFile(name string) ([]byte, error) {
+	file, err := d.fs.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RawSuffix ends the name of a template file copied verbatim, it is removed from the name (logo.png.raw).
+const RawSuffix = ".raw"
+
+// binarySniffLength is the length of the beginning of a file searched for a NUL byte, like git does.
+const binarySniffLength = 8000
+
+// isBinary tells if a content looks binary, it is then copied verbatim.
+func isBinary(content []byte) bool {
+	if len(content) > binarySniffLength {
+		content = content[:binarySniffLength]
+	}
+
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// checkRawPatterns returns an error if a pattern of raw files is malformed.
+func checkRawPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: %q", err, pattern)
+		}
+	}
+
+	return nil
+}
+
+// isRaw tells if a template file is copied verbatim: its name ends with RawSuffix or it matches one of the raw
+// patterns. A pattern without a slash matches the name of the file, else its path relative to the template root.
+func (d Driver) isRaw(templatePath string) bool {
+	if strings.HasSuffix(templatePath, RawSuffix) {
+		return true
+	}
+
+	relative := d.relativePath(templatePath)
+
+	for _, pattern := range d.raw {
+		name := relative
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(relative)
+		}
+
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package filetree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrUnsafePath is returned when a developed name would be written outside of the output directory.
+	ErrUnsafePath = errors.New("unsafe target path")
+	// ErrUnknownPolicy is returned when parsing an unknown policy name.
+	ErrUnknownPolicy = errors.New("unknown policy")
+)
+
+// SeparatorPolicy tells what to do with a developed name containing a path separator (/ or \).
+type SeparatorPolicy int
+
+const (
+	// SeparatorReject fails the generation, it is the default.
+	SeparatorReject SeparatorPolicy = iota
+	// SeparatorReplace replaces each separator with an underscore.
+	SeparatorReplace
+	// SeparatorAllow creates the subdirectories, the target must still be inside of the output directory.
+	SeparatorAllow
+)
+
+// ParseSeparatorPolicy returns the policy with a name: reject, replace or allow.
+func ParseSeparatorPolicy(name string) (SeparatorPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "reject":
+		return SeparatorReject, nil
+	case "replace":
+		return SeparatorReplace, nil
+	case "allow":
+		return SeparatorAllow, nil
+	default:
+		return SeparatorReject, fmt.Errorf("%w %s", ErrUnknownPolicy, name)
+	}
+}
+
+// targetPath joins a developed name to the path of its parent, the result is always inside of the output directory.
+func (d Driver) targetPath(parent string, name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		switch d.separators {
+		case SeparatorReject:
+			return "", fmt.Errorf("%w: %q contains a path separator", ErrUnsafePath, name)
+		case SeparatorReplace:
+			name = strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+		case SeparatorAllow:
+			name = strings.ReplaceAll(name, `\`, "/")
+		}
+	}
+
+	if path.IsAbs(name) {
+		return "", fmt.Errorf("%w: %q is an absolute path", ErrUnsafePath, name)
+	}
+
+	name, err := d.portableName(name)
+	if err != nil {
+		return "", err
+	}
+
+	if d.separators != SeparatorAllow && (name == "." || name == "..") {
+		return "", fmt.Errorf("%w: %q is not a valid name", ErrUnsafePath, name)
+	}
+
+	target := path.Join(parent, name)
+
+	if target == path.Clean(parent) || !isWithin(d.root, target) {
+		return "", fmt.Errorf("%w: %q is outside of %s", ErrUnsafePath, name, d.root)
+	}
+
+	if err := d.checkLinks(target); err != nil {
+		return "", fmt.Errorf("%w: %q: %w", ErrUnsafePath, name, err)
+	}
+
+	if err := d.checkPathLength(target); err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+// isWithin tells if a cleaned target is strictly inside of the root directory.
+func isWithin(root string, target string) bool {
+	switch {
+	case target == root:
+		return false
+	case root == ".":
+		return target != ".." && !strings.HasPrefix(target, "../") && !path.IsAbs(target)
+	default:
+		return strings.HasPrefix(target, strings.TrimSuffix(root, "/")+"/")
+	}
+}
+
+// errLinkEscape is returned when the symbolic links of a target lead outside of the output directory.
+var errLinkEscape = errors.New("symbolic link outside of the output directory")
+
+// checkLinks returns an error if the file system has symbolic links and the deepest existing entry of a target
+// resolves outside of the output directory, the missing entries are created below it.
+func (d Driver) checkLinks(target string) error {
+	resolver, ok := d.fs.(SymlinkResolver)
+	if !ok {
+		return nil
+	}
+
+	root, err := resolveExisting(resolver, d.root)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := resolveExisting(resolver, target)
+	if err != nil {
+		return err
+	}
+
+	if !isWithin(root, resolved) {
+		return fmt.Errorf("%w: %s is %s", errLinkEscape, target, resolved)
+	}
+
+	return nil
+}
+
+// resolveExisting resolves the symbolic links of the deepest existing entry of a path, the missing entries are joined
+// to the result.
+func resolveExisting(resolver SymlinkResolver, name string) (string, error) {
+	missing := ""
+
+	for entry := name; ; entry = path.Dir(entry) {
+		resolved, err := resolver.EvalSymlinks(entry)
+		if err == nil {
+			return path.Join(resolved, missing), nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) || entry == path.Dir(entry) {
+			return "", fmt.Errorf("%w", err)
+		}
+
+		missing = path.Join(path.Base(entry), missing)
+	}
+}
+
+// mkdirParents creates the directories between the output directory and a target developed from a name containing
+// separators, outermost first.
+func (d Driver) mkdirParents(target string) error {
+	dirs := []string{}
+
+	for dir := path.Dir(target); isWithin(d.root, dir); dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	for _, dir := range dirs {
+		if err := d.fs.Mkdir(dir, os.ModePerm); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	return nil
+}
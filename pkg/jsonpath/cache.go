@@ -0,0 +1,81 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package jsonpath
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cache is a bounded cache safe for concurrent use, the least recently used entry is evicted when it is full.
+type cache[K comparable, V any] struct {
+	mutex    sync.Mutex
+	capacity int
+	order    *list.List // of cacheEntry, most recently used first
+	entries  map[K]*list.Element
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newCache[K comparable, V any](capacity int) *cache[K, V] {
+	return &cache[K, V]{
+		mutex:    sync.Mutex{},
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[K]*list.Element{},
+	}
+}
+
+func (c *cache[K, V]) Load(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		var zero V
+
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return element.Value.(cacheEntry[K, V]).value, true //nolint:forcetypeassert
+}
+
+func (c *cache[K, V]) Store(key K, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = cacheEntry[K, V]{key: key, value: value}
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(cacheEntry[K, V]{key: key, value: value})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(cacheEntry[K, V]).key) //nolint:forcetypeassert
+	}
+}
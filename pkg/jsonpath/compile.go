@@ -0,0 +1,516 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	patternStack = regexp.MustCompile(`^\$\[(-?\d+)\]$`)
+	patternIndex = regexp.MustCompile(`^\[(-?\d+)\]$`)
+	patternSlice = regexp.MustCompile(`^\[(-?\d*):(-?\d*)(?::(-?\d*))?\]$`)
+	patternPlain = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// compiledCapacity bounds the cache of compiled paths, paths given to the Get functions of templates can be
+// built from the data.
+const compiledCapacity = 1024
+
+// compiled caches the paths compiled by GetScope and the developers, path expressions of a template tree
+// are evaluated again for each item of each context.
+//
+//nolint:gochecknoglobals
+var compiled = newCache[compiledKey, *Path](compiledCapacity)
+
+type compiledKey struct {
+	expression string
+	dialect    Dialect
+}
+
+// SyntaxError reports an invalid path expression with the column (in runes, starting at 1) of the error.
+type SyntaxError struct {
+	Expression string
+	Column     int
+	Message    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%v: %s at column %d: %s", ErrInvalidPath, e.Expression, e.Column, e.Message)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrInvalidPath
+}
+
+// Segment is a step of a compiled path.
+type Segment interface {
+	fmt.Stringer
+	isSegment()
+}
+
+// StackSegment starts a path from an element of the stack: $ is the top of the stack, $[n] an element by index.
+type StackSegment struct {
+	Index   int
+	Indexed bool
+}
+
+// RootSegment starts a path from the root of the stack, the context document, it is the $ of RFC 9535.
+type RootSegment struct{}
+
+// KeySegment selects the value of a key.
+type KeySegment struct {
+	Key string
+}
+
+// WildcardSegment iterates over the items of a list ([]), or the values of a list or an object (*),
+// selecting the keys instead of the values (*~) if Keys is true.
+type WildcardSegment struct {
+	Objects bool
+	Keys    bool
+}
+
+// IndexSegment selects an item of a list, negative indexes start from the end.
+type IndexSegment struct {
+	Index int
+}
+
+// SliceSegment selects the items of a list between two bounds, bounds and step are optional.
+type SliceSegment struct {
+	Start *int
+	End   *int
+	Step  *int
+}
+
+// FilterSegment keeps the items of a list, or the values of an object, matching a filter expression.
+type FilterSegment struct {
+	Expression string
+	filter     filterNode
+}
+
+// DescentSegment follows the rest of the path from every level.
+type DescentSegment struct{}
+
+// UnionSegment selects the entries of several selectors as a single iteration level ([0, 2], ['a', 'b']),
+// it only exists in the RFC 9535 dialect.
+type UnionSegment struct {
+	Selectors []Segment
+}
+
+func (StackSegment) isSegment()    {}
+func (RootSegment) isSegment()     {}
+func (KeySegment) isSegment()      {}
+func (WildcardSegment) isSegment() {}
+func (IndexSegment) isSegment()    {}
+func (SliceSegment) isSegment()    {}
+func (FilterSegment) isSegment()   {}
+func (DescentSegment) isSegment()  {}
+func (UnionSegment) isSegment()    {}
+
+func (s StackSegment) String() string {
+	if s.Indexed {
+		return fmt.Sprintf("$[%d]", s.Index)
+	}
+
+	return "$"
+}
+
+func (RootSegment) String() string {
+	return "$"
+}
+
+func (s KeySegment) String() string {
+	if patternPlain.MatchString(s.Key) {
+		return s.Key
+	}
+
+	return "['" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s.Key) + "']"
+}
+
+func (s WildcardSegment) String() string {
+	switch {
+	case s.Keys:
+		return "*~"
+	case s.Objects:
+		return "*"
+	default:
+		return "[]"
+	}
+}
+
+func (s IndexSegment) String() string {
+	return fmt.Sprintf("[%d]", s.Index)
+}
+
+func (s SliceSegment) String() string {
+	bound := func(value *int) string {
+		if value == nil {
+			return ""
+		}
+
+		return strconv.Itoa(*value)
+	}
+
+	if s.Step == nil {
+		return "[" + bound(s.Start) + ":" + bound(s.End) + "]"
+	}
+
+	return "[" + bound(s.Start) + ":" + bound(s.End) + ":" + bound(s.Step) + "]"
+}
+
+func (s FilterSegment) String() string {
+	return "[?" + s.Expression + "]"
+}
+
+func (DescentSegment) String() string {
+	return ".."
+}
+
+func (s UnionSegment) String() string {
+	selectors := make([]string, len(s.Selectors))
+	for i, selector := range s.Selectors {
+		selectors[i] = strings.TrimSuffix(strings.TrimPrefix(selector.String(), "["), "]")
+
+		if key, ok := selector.(KeySegment); ok {
+			selectors[i] = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(key.Key) + "'"
+		}
+	}
+
+	return "[" + strings.Join(selectors, ", ") + "]"
+}
+
+// ErrUnknownDialect is returned by ParseDialect for an unknown name.
+var ErrUnknownDialect = errors.New("unknown dialect")
+
+// Dialect is the syntax of path expressions.
+type Dialect int
+
+const (
+	// DialectEmportePiece is the syntax of emporte-piece ({{tables.[].name}}, {{$[-2].name}}).
+	DialectEmportePiece Dialect = iota
+	// DialectRFC9535 is the standard JSONPath syntax ({{$.tables[*].name}}), $ is the context document.
+	DialectRFC9535
+)
+
+// ParseDialect returns the dialect with a name: emporte-piece or rfc9535.
+func ParseDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "", "emporte-piece":
+		return DialectEmportePiece, nil
+	case "rfc9535", "rfc-9535":
+		return DialectRFC9535, nil
+	default:
+		return DialectEmportePiece, fmt.Errorf("%w %s", ErrUnknownDialect, name)
+	}
+}
+
+func (d Dialect) String() string {
+	if d == DialectRFC9535 {
+		return "rfc9535"
+	}
+
+	return "emporte-piece"
+}
+
+// Path is a compiled path expression, it can be evaluated many times on different stacks.
+type Path struct {
+	expression string
+	segments   []Segment
+	dialect    Dialect
+}
+
+// Compile parses a path expression, syntax errors are returned as a *SyntaxError.
+func Compile(expression string) (*Path, error) {
+	segments, err := compileSegments(expression, expression, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Path{expression: expression, segments: segments, dialect: DialectEmportePiece}, nil
+}
+
+// CompileDialect parses a path expression written in a dialect.
+func CompileDialect(expression string, dialect Dialect) (*Path, error) {
+	if dialect == DialectRFC9535 {
+		return CompileRFC9535(expression)
+	}
+
+	return Compile(expression)
+}
+
+// MustCompile is like Compile but panics if the expression is invalid.
+func MustCompile(expression string) *Path {
+	path, err := Compile(expression)
+	if err != nil {
+		panic(err)
+	}
+
+	return path
+}
+
+// compileCached returns the compiled path of an expression, compiling it only the first time.
+func compileCached(expression string, dialect Dialect) (*Path, error) {
+	key := compiledKey{expression: expression, dialect: dialect}
+
+	if path, ok := compiled.Load(key); ok {
+		return path, nil
+	}
+
+	path, err := CompileDialect(expression, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled.Store(key, path)
+
+	return path, nil
+}
+
+func (p *Path) String() string {
+	return p.expression
+}
+
+// Dialect returns the dialect in which the path was written.
+func (p *Path) Dialect() Dialect {
+	return p.dialect
+}
+
+// Segments returns the steps of the path.
+func (p *Path) Segments() []Segment {
+	return append([]Segment{}, p.segments...)
+}
+
+// Evaluate evaluates the path on a stack, like Get.
+func (p *Path) Evaluate(contexts ...any) ([]Result, error) {
+	return p.EvaluateScope(Scope{Stack: contexts, Vars: nil, Loops: nil})
+}
+
+// EvaluateScope evaluates the path on a scope, like GetScope.
+func (p *Path) EvaluateScope(scope Scope) ([]Result, error) {
+	return evaluator{strict: false, root: nil, dialect: p.dialect}.evaluate(p, scope)
+}
+
+type token struct {
+	text   string
+	column int
+}
+
+// compileSegments compiles the segments of a text found at an offset of an expression,
+// so that errors report columns of the whole expression. Only a path can start from the stack ($).
+func compileSegments(expression string, text string, offset int, withStack bool) ([]Segment, error) {
+	tokens, err := tokenize(expression, text, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]Segment, 0, len(tokens))
+
+	for index, token := range tokens {
+		segment, err := compileSegment(expression, token, withStack && index == 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if wildcard, ok := segment.(WildcardSegment); ok && wildcard.Keys && index < len(tokens)-1 {
+			return nil, &SyntaxError{Expression: expression, Column: token.column, Message: "*~ must be the last segment"}
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+//nolint:cyclop
+func compileSegment(expression string, token token, withStack bool) (Segment, error) {
+	text := token.text
+	fail := func(format string, args ...any) (Segment, error) {
+		return nil, &SyntaxError{Expression: expression, Column: token.column, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch {
+	case text == "..":
+		return DescentSegment{}, nil
+	case text == "$" || patternStack.MatchString(text):
+		if !withStack {
+			return fail("%s must start the path", text)
+		}
+
+		if text == "$" {
+			return StackSegment{Index: 0, Indexed: false}, nil
+		}
+
+		index, _ := strconv.Atoi(patternStack.FindStringSubmatch(text)[1])
+
+		return StackSegment{Index: index, Indexed: true}, nil
+	case text == "[]":
+		return WildcardSegment{Objects: false, Keys: false}, nil
+	case text == "*":
+		return WildcardSegment{Objects: true, Keys: false}, nil
+	case text == "*~":
+		return WildcardSegment{Objects: true, Keys: true}, nil
+	case patternIndex.MatchString(text):
+		index, _ := strconv.Atoi(patternIndex.FindStringSubmatch(text)[1])
+
+		return IndexSegment{Index: index}, nil
+	case patternSlice.MatchString(text):
+		match := patternSlice.FindStringSubmatch(text)
+
+		return SliceSegment{Start: parseBound(match[1]), End: parseBound(match[2]), Step: parseBound(match[3])}, nil
+	case strings.HasPrefix(text, "[?") && strings.HasSuffix(text, "]"):
+		filter, err := parseFilter(expression, text[2:len(text)-1], token.column+1)
+		if err != nil {
+			return nil, err
+		}
+
+		return FilterSegment{Expression: text[2 : len(text)-1], filter: filter}, nil
+	case isQuoted(text):
+		key, err := unescape(text[2:len(text)-2], rune(text[1]))
+		if err != nil {
+			return fail("%v", err)
+		}
+
+		return KeySegment{Key: key}, nil
+	case strings.HasPrefix(text, "["):
+		return fail("unknown segment %s", text)
+	case text == "":
+		return fail("empty segment")
+	}
+
+	key, err := unescape(text, 0)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	return KeySegment{Key: key}, nil
+}
+
+func parseBound(bound string) *int {
+	if bound == "" {
+		return nil
+	}
+
+	value, _ := strconv.Atoi(bound)
+
+	return &value
+}
+
+func isQuoted(segment string) bool {
+	return len(segment) >= 4 && segment[0] == '[' && segment[len(segment)-1] == ']' &&
+		(segment[1] == '\'' || segment[1] == '"') && segment[len(segment)-2] == segment[1]
+}
+
+// tokenize splits a path on dots, except inside brackets, parenthesis and quotes or after a backslash.
+// Two consecutive dots produce a recursive descent token (..).
+//
+//nolint:cyclop,funlen
+func tokenize(expression string, text string, offset int) ([]token, error) {
+	tokens := []token{}
+	segment := strings.Builder{}
+	begin := 0
+	depth := 0
+	opened := 0
+	quote := rune(0)
+	escaped := false
+	descent := false
+	runes := []rune(text)
+
+	fail := func(column int, message string) ([]token, error) {
+		return nil, &SyntaxError{Expression: expression, Column: offset + column + 1, Message: message}
+	}
+
+	emit := func(index int) {
+		tokens = append(tokens, token{text: segment.String(), column: offset + begin + 1})
+		segment.Reset()
+
+		begin = index
+	}
+
+	for index, char := range runes {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+			opened = index
+		case char == '[' && depth == 0 && segment.Len() > 0 && segment.String() != "$":
+			// a bracket segment can follow a key without a dot (labels['app.kubernetes.io/name'])
+			emit(index)
+
+			depth++
+			opened = index
+		case char == '[' || char == '(':
+			if depth == 0 {
+				opened = index
+			}
+
+			depth++
+		case char == ']' || char == ')':
+			depth--
+
+			if depth < 0 {
+				return fail(index, fmt.Sprintf("unexpected %c", char))
+			}
+		case char == '.' && depth == 0:
+			switch {
+			case descent:
+				tokens = append(tokens, token{text: "..", column: offset + index})
+				descent = false
+			case index+1 < len(runes) && runes[index+1] == '.':
+				if index > 0 {
+					emit(index)
+				}
+
+				descent = true
+			default:
+				emit(index)
+			}
+
+			segment.Reset()
+
+			begin = index + 1
+
+			continue
+		}
+
+		segment.WriteRune(char)
+	}
+
+	switch {
+	case escaped:
+		return fail(len(runes)-1, "incomplete escape sequence")
+	case quote != 0:
+		return fail(opened, "unterminated quote")
+	case depth != 0:
+		return fail(opened, "unbalanced brackets")
+	case descent || (segment.Len() == 0 && len(tokens) > 0 && tokens[len(tokens)-1].text == ".."):
+		return fail(len(runes), "recursive descent must be followed by a segment")
+	}
+
+	return append(tokens, token{text: segment.String(), column: offset + begin + 1}), nil
+}
@@ -0,0 +1,606 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package jsonpath
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	gotemplate "text/template"
+)
+
+var (
+	patternAlias = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	patternLoop  = regexp.MustCompile(`^@(?:\[(-?\d+)\]\.?)?(index|number|count|first|last|key)(%[-+# 0-9.]*[a-zA-Z])?$`)
+)
+
+// Developer develops the path expressions of templates. A path expression can be followed by a pipeline
+// of functions ({{tables.[].name | ToLower | kebabcase}}) evaluated with text/template on the selected value.
+type Developer struct {
+	funcs        gotemplate.FuncMap
+	strict       bool
+	dialect      Dialect
+	left         string
+	right        string
+	placeholders *cache[placeholderKey, placeholder] // parsed with the functions of the developer
+}
+
+type placeholderKey struct {
+	expression string
+	dialect    Dialect
+}
+
+const (
+	// DefaultLeftDelim opens the path expressions of a template.
+	DefaultLeftDelim = "{{"
+	// DefaultRightDelim closes the path expressions of a template.
+	DefaultRightDelim = "}}"
+)
+
+func NewDeveloper() Developer {
+	return Developer{
+		funcs:        gotemplate.FuncMap{},
+		strict:       false,
+		dialect:      DialectEmportePiece,
+		left:         DefaultLeftDelim,
+		right:        DefaultRightDelim,
+		placeholders: newCache[placeholderKey, placeholder](compiledCapacity),
+	}
+}
+
+// WithStrict returns a copy of the developer that fails on missing keys instead of selecting a nil value.
+func (d Developer) WithStrict(strict bool) Developer {
+	d.strict = strict
+
+	return d
+}
+
+// WithDialect returns a copy of the developer that parses the paths of placeholders in a dialect.
+func (d Developer) WithDialect(dialect Dialect) Developer {
+	d.dialect = dialect
+
+	return d
+}
+
+// WithDelims returns a copy of the developer that finds the path expressions between other delimiters
+// (<<tables.[].name>>), an empty delimiter is the default one.
+func (d Developer) WithDelims(left string, right string) Developer {
+	d.left, d.right = DefaultLeftDelim, DefaultRightDelim
+
+	if left != "" {
+		d.left = left
+	}
+
+	if right != "" {
+		d.right = right
+	}
+
+	return d
+}
+
+// Get evaluates a path on the scope, like GetScope, in the mode and the dialect of the developer.
+func (d Developer) Get(path string, scope Scope) ([]Result, error) {
+	compiled, err := compileCached(path, d.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluator{strict: d.strict, root: nil, dialect: d.dialect}.evaluate(compiled, scope)
+}
+
+// WithFuncs returns a copy of the developer that can use the functions in pipelines.
+func (d Developer) WithFuncs(funcs gotemplate.FuncMap) Developer {
+	merged := gotemplate.FuncMap{}
+
+	for name, fn := range d.funcs {
+		merged[name] = fn
+	}
+
+	for name, fn := range funcs {
+		merged[name] = fn
+	}
+
+	d.funcs = merged
+	d.placeholders = newCache[placeholderKey, placeholder](compiledCapacity)
+
+	return d
+}
+
+func Develop(template string, contexts ...any) ([]ResultString, error) {
+	return NewDeveloper().Develop(template, Scope{Stack: contexts, Vars: nil, Loops: nil})
+}
+
+func DevelopScope(template string, scope Scope) ([]ResultString, error) {
+	return NewDeveloper().Develop(template, scope)
+}
+
+// Develop develops the path expressions of the template in a scope,
+// an alias (tables.[].name as table) binds a variable for the rest of the template and the scopes of the results.
+// Loop metadata (@index, @[-2].key) are resolved last, with the iteration levels of the whole template.
+func (d Developer) Develop(template string, scope Scope) ([]ResultString, error) {
+	developments, err := d.developFragments(template, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	resultstrings := make([]ResultString, 0, len(developments))
+
+	for _, development := range developments {
+		selected := strings.Builder{}
+
+		for _, fragment := range development.fragments {
+			if fragment.loopRef == "" {
+				selected.WriteString(fragment.text)
+
+				continue
+			}
+
+			value, err := resolveLoop(fragment.loopRef, development.scope.Loops)
+			if err != nil {
+				return nil, err
+			}
+
+			text, err := render(value, fragment.pipe)
+			if err != nil {
+				return nil, err
+			}
+
+			selected.WriteString(text)
+		}
+
+		resultstrings = append(resultstrings, ResultString{
+			Selected: selected.String(),
+			Stack:    development.scope.Stack,
+			Vars:     development.scope.Vars,
+			Loops:    development.scope.Loops,
+		})
+	}
+
+	return resultstrings, nil
+}
+
+// fragment is a part of a developed template, either a text or a reference to loop metadata not resolved yet.
+type fragment struct {
+	text    string
+	loopRef string
+	pipe    *gotemplate.Template
+}
+
+type development struct {
+	fragments []fragment
+	scope     Scope
+}
+
+// placeholder is the content of a path expression: [?]path [?: default] [as alias] [| pipeline].
+// A conditional placeholder (?path) keeps only truthy values and is developed to an empty string.
+// The default value replaces a missing or null value, it is a string, number, boolean or null literal.
+type placeholder struct {
+	path         string
+	compiled     *Path
+	alias        string
+	pipe         *gotemplate.Template
+	conditional  bool
+	hasDefault   bool
+	defaultValue any
+}
+
+// cachedPlaceholder returns the parsed placeholder of an expression, parsing it only the first time:
+// the names of a template tree are developed again for each item of each context.
+func (d Developer) cachedPlaceholder(expression string) (placeholder, error) {
+	if d.placeholders == nil {
+		return d.parsePlaceholder(expression)
+	}
+
+	key := placeholderKey{expression: expression, dialect: d.dialect}
+
+	if parsed, ok := d.placeholders.Load(key); ok {
+		return parsed, nil
+	}
+
+	parsed, err := d.parsePlaceholder(expression)
+	if err != nil {
+		return parsed, err
+	}
+
+	d.placeholders.Store(key, parsed)
+
+	return parsed, nil
+}
+
+func (d Developer) parsePlaceholder(expression string) (placeholder, error) {
+	result := placeholder{path: "", compiled: nil, alias: "", pipe: nil, conditional: false, hasDefault: false, defaultValue: nil}
+
+	expression, pipeline := splitPipe(expression)
+	var err error
+	if result.path, result.alias, err = splitAlias(expression); err != nil {
+		return result, err
+	}
+
+	if path, literal, ok := splitDefault(result.path); ok {
+		value, err := parseLiteral(literal)
+		if err != nil {
+			return result, err
+		}
+
+		result.path, result.hasDefault, result.defaultValue = path, true, value
+	}
+
+	if strings.HasPrefix(result.path, "?") {
+		result.conditional = true
+		result.path = strings.TrimSpace(result.path[1:])
+	}
+
+	if !strings.HasPrefix(result.path, "@") {
+		compiled, err := compileCached(result.path, d.dialect)
+		if err != nil {
+			return result, err
+		}
+
+		result.compiled = compiled
+	}
+
+	if pipeline != "" {
+		pipe, err := gotemplate.New("pipe").Funcs(d.funcs).Parse("{{$ | " + pipeline + "}}")
+		if err != nil {
+			return result, fmt.Errorf("%w: invalid pipeline in %s: %v", ErrInvalidPath, expression, err) //nolint:errorlint
+		}
+
+		result.pipe = pipe
+	}
+
+	return result, nil
+}
+
+func (d Developer) developFragments(template string, scope Scope) ([]development, error) {
+	expression, pathBegin, pathEnd := extractPath(template, d.left, d.right)
+
+	if len(expression) == 0 {
+		return []development{{fragments: []fragment{{text: template, loopRef: "", pipe: nil}}, scope: scope}}, nil
+	}
+
+	placeholder, err := d.cachedPlaceholder(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fragment{text: template[0:pathBegin], loopRef: "", pipe: nil}
+
+	if strings.HasPrefix(placeholder.path, "@") {
+		loopRef := fragment{text: "", loopRef: placeholder.path, pipe: placeholder.pipe}
+
+		return d.developSuffix(template[pathEnd:], scope, prefix, loopRef)
+	}
+
+	results, err := d.get(placeholder, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	developments := []development{}
+
+	for _, result := range results {
+		if placeholder.conditional && !truthy(result.Selected) {
+			continue
+		}
+
+		if placeholder.alias != "" {
+			result.Vars = bind(result.Vars, placeholder.alias, result.item())
+		}
+
+		text := ""
+		if !placeholder.conditional {
+			text, err = render(result.Selected, placeholder.pipe)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// the rest of the template is developed with the scope produced by this expansion
+		suffixes, err := d.developSuffix(template[pathEnd:], Scope{Stack: result.Stack, Vars: result.Vars, Loops: result.Loops},
+			prefix, fragment{text: text, loopRef: "", pipe: nil})
+		if err != nil {
+			return nil, err
+		}
+
+		developments = append(developments, suffixes...)
+	}
+
+	return developments, nil
+}
+
+// get evaluates the path of a placeholder, the default value is selected where the value is missing or null,
+// or once if the path selects nothing. Conditional placeholders and placeholders with a default are never strict.
+func (d Developer) get(placeholder placeholder, scope Scope) ([]Result, error) {
+	strict := d.strict && !placeholder.conditional && !placeholder.hasDefault
+
+	results, err := evaluator{strict: strict, root: nil, dialect: d.dialect}.evaluate(placeholder.compiled, scope)
+	if err != nil || !placeholder.hasDefault {
+		return results, err
+	}
+
+	if len(results) == 0 {
+		return []Result{{
+			Selected: placeholder.defaultValue,
+			Stack:    push(scope.Stack, placeholder.defaultValue),
+			Vars:     scope.Vars,
+			Loops:    scope.Loops,
+			iterated: 0,
+		}}, nil
+	}
+
+	for i := range results {
+		if results[i].Selected == nil {
+			results[i].Selected = placeholder.defaultValue
+			results[i].Stack[len(results[i].Stack)-1] = placeholder.defaultValue
+		}
+	}
+
+	return results, nil
+}
+
+func (d Developer) developSuffix(suffix string, scope Scope, fragments ...fragment) ([]development, error) {
+	suffixes, err := d.developFragments(suffix, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range suffixes {
+		suffixes[i].fragments = append(append([]fragment{}, fragments...), suffixes[i].fragments...)
+	}
+
+	return suffixes, nil
+}
+
+// render converts a selected value to a string, through the pipeline if any.
+func render(value any, pipe *gotemplate.Template) (string, error) {
+	if pipe == nil {
+		return toString(value), nil
+	}
+
+	data, err := Plain(value)
+	if err != nil {
+		return "", err
+	}
+
+	result := &bytes.Buffer{}
+	if err := pipe.Execute(result, data); err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return result.String(), nil
+}
+
+// truthy follows the definition of text/template: false, 0, nil, empty strings, lists and objects are false.
+func truthy(value any) bool {
+	if ordered, ok := value.(*OrderedMap); ok {
+		return ordered.Len() > 0
+	}
+
+	truth, ok := gotemplate.IsTrue(value)
+
+	return truth && ok
+}
+
+// resolveLoop returns the value of a loop metadata reference: @field or @[level].field,
+// with an optional format (@number%02d).
+func resolveLoop(ref string, loops []Loop) (any, error) {
+	match := patternLoop.FindStringSubmatch(ref)
+	if match == nil {
+		return nil, fmt.Errorf("%w: unknown loop metadata %s", ErrInvalidPath, ref)
+	}
+
+	level := -1
+	if match[1] != "" {
+		level, _ = strconv.Atoi(match[1])
+	}
+
+	if level < 0 {
+		level += len(loops)
+	}
+
+	if level < 0 || level >= len(loops) {
+		return nil, fmt.Errorf("%w: no iteration level for %s", ErrInvalidPath, ref)
+	}
+
+	loop := loops[level]
+	value := map[string]any{
+		"index":  loop.Index,
+		"number": loop.Number,
+		"count":  loop.Count,
+		"first":  loop.First,
+		"last":   loop.Last,
+		"key":    loop.Key,
+	}[match[2]]
+
+	if match[3] != "" {
+		return fmt.Sprintf(match[3], value), nil
+	}
+
+	return value, nil
+}
+
+// splitPipe separates the expression from its pipeline, on the first | outside of brackets, parenthesis and quotes.
+func splitPipe(expression string) (string, string) {
+	depth := 0
+	quote := rune(0)
+	escaped := false
+	runes := []rune(expression)
+
+	for index, char := range runes {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+		case char == '[' || char == '(':
+			depth++
+		case char == ']' || char == ')':
+			depth--
+		case char == '|' && depth == 0:
+			return strings.TrimSpace(string(runes[:index])), strings.TrimSpace(string(runes[index+1:]))
+		}
+	}
+
+	return strings.TrimSpace(expression), ""
+}
+
+// splitDefault separates the path from its default value (path ?: "default"), on the first ?: outside of
+// brackets, parenthesis and quotes.
+func splitDefault(expression string) (string, string, bool) {
+	depth := 0
+	quote := rune(0)
+	escaped := false
+	runes := []rune(expression)
+
+	for index, char := range runes {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+		case char == '[' || char == '(':
+			depth++
+		case char == ']' || char == ')':
+			depth--
+		case char == '?' && depth == 0 && index+1 < len(runes) && runes[index+1] == ':':
+			return strings.TrimSpace(string(runes[:index])), strings.TrimSpace(string(runes[index+2:])), true
+		}
+	}
+
+	return expression, "", false
+}
+
+// splitAlias separates the path from the alias of an expression (path as alias), on the last " as " outside of
+// brackets, parenthesis and quotes. A missing or invalid alias is an error.
+func splitAlias(expression string) (string, string, error) {
+	depth := 0
+	quote := rune(0)
+	escaped := false
+	runes := []rune(expression)
+	separator := -1
+
+	for index, char := range runes {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+		case char == '[' || char == '(':
+			depth++
+		case char == ']' || char == ')':
+			depth--
+		case char == ' ' && depth == 0 && (strings.HasPrefix(string(runes[index:]), " as ") || string(runes[index:]) == " as"):
+			separator = index
+		}
+	}
+
+	if separator < 0 {
+		return strings.TrimSpace(expression), "", nil
+	}
+
+	alias := strings.TrimSpace(string(runes[separator+len(" as"):]))
+	if !patternAlias.MatchString(alias) {
+		return "", "", fmt.Errorf("%w: invalid alias %q in %s", ErrInvalidPath, alias, expression)
+	}
+
+	return strings.TrimSpace(string(runes[:separator])), alias, nil
+}
+
+// bind returns a copy of the variables with a new value, variables of the parent scope are left untouched.
+func bind(vars map[string]any, name string, value any) map[string]any {
+	result := make(map[string]any, len(vars)+1)
+	for key, existing := range vars {
+		result[key] = existing
+	}
+
+	result[name] = value
+
+	return result
+}
+
+// extractPath returns the first path expression of a template, between the left and the right delimiters,
+// with the position of its left delimiter and the position following its right delimiter.
+func extractPath(template string, left string, right string) (string, int, int) {
+	pathBegin := strings.Index(template, left)
+	if pathBegin < 0 {
+		return "", 0, 0
+	}
+
+	length := strings.Index(template[pathBegin+len(left):], right)
+	if length < 0 {
+		return "", 0, 0
+	}
+
+	pathEnd := pathBegin + len(left) + length + len(right)
+
+	return template[pathBegin+len(left) : pathBegin+len(left)+length], pathBegin, pathEnd
+}
+
+//nolint:gocyclop,cyclop
+func toString(v any) string {
+	switch vTyped := v.(type) {
+	case string:
+		return vTyped
+	case fmt.Stringer:
+		return vTyped.String()
+	case int:
+		return strconv.Itoa(vTyped)
+	case int64:
+		return strconv.FormatInt(vTyped, 10)
+	case int32:
+		return strconv.FormatInt(int64(vTyped), 10)
+	case int16:
+		return strconv.FormatInt(int64(vTyped), 10)
+	case int8:
+		return strconv.FormatInt(int64(vTyped), 10)
+	case uint:
+		return strconv.FormatUint(uint64(vTyped), 10)
+	case uint64:
+		return strconv.FormatUint(vTyped, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(vTyped), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(vTyped), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(vTyped), 10)
+	case bool:
+		return strconv.FormatBool(vTyped)
+	default:
+		return fmt.Sprintf("%v", vTyped)
+	}
+}
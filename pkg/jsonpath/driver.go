@@ -18,78 +18,199 @@
 package jsonpath
 
 import (
+	"errors"
 	"fmt"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf16"
 )
 
-var patternStack = regexp.MustCompile(`^\$\[(-?\d+)\]$`)
+var (
+	ErrInvalidPath = errors.New("invalid path")
+	ErrMissingKey  = errors.New("missing key")
+	// ErrCyclicContext is returned when a value of the context contains itself, through pointers, maps or slices.
+	ErrCyclicContext = errors.New("cyclic context")
+
+	errInvalidEscape = errors.New("invalid escape sequence")
+)
 
 func Get(path string, contexts ...any) ([]Result, error) {
-	context := contexts[0]
-	paths := strings.Split(path, ".")
+	return GetScope(path, Scope{Stack: contexts, Vars: nil, Loops: nil})
+}
 
-	if paths[0][0] == '$' {
-		context, contexts = refreshContext(paths, contexts)
-		paths = paths[1:]
+// GetScope evaluates a path on the stack of the scope, the first key of the path can be a variable of the scope.
+func GetScope(path string, scope Scope) ([]Result, error) {
+	compiled, err := compileCached(path, DialectEmportePiece)
+	if err != nil {
+		return nil, err
 	}
 
-	return get(context, paths, contexts)
+	return evaluator{strict: false, root: nil, dialect: DialectEmportePiece}.evaluate(compiled, scope)
+}
+
+// evaluator follows the segments of a path, in strict mode a missing key is an error instead of a nil value.
+// The root is the value selected by $ in RFC 9535 filters, where a missing key selects nothing.
+type evaluator struct {
+	strict  bool
+	root    any
+	dialect Dialect
 }
 
-func refreshContext(paths []string, contexts []any) (any, []any) {
-	if patternStack.MatchString(paths[0]) {
-		stackindexstr := patternStack.FindStringSubmatch(paths[0])[1]
-		stackindex, _ := strconv.Atoi(stackindexstr)
+func (e evaluator) evaluate(path *Path, scope Scope) ([]Result, error) {
+	contexts := scope.Stack
+	segments := path.segments
 
-		if stackindex < 0 {
-			return contexts[len(contexts)+stackindex], contexts[:len(contexts)+stackindex+1]
+	var context any
+	if len(contexts) > 0 {
+		context = contexts[0]
+	}
+
+	switch first := segments[0].(type) {
+	case StackSegment:
+		var ok bool
+		if context, contexts, ok = refreshContext(first, contexts); !ok {
+			return nil, e.stackError(path, len(contexts))
 		}
 
-		return contexts[stackindex], contexts[:stackindex]
+		segments = segments[1:]
+	case RootSegment:
+		segments = segments[1:]
+	case KeySegment:
+		if value, ok := scope.Vars[first.Key]; ok {
+			context = value
+			segments = segments[1:]
+		}
 	}
 
-	return contexts[len(contexts)-1], contexts[:len(contexts)-1]
+	e.root, e.dialect = context, path.dialect
+
+	loops := keepLoops(scope.Loops, len(contexts))
+
+	if len(segments) == 0 {
+		return []Result{{Selected: context, Stack: push(contexts, context), Vars: scope.Vars, Loops: loops, iterated: 0}}, nil
+	}
+
+	results, err := e.get(context, segments, contexts)
+	if errors.Is(err, ErrMissingKey) {
+		err = fmt.Errorf("%w in %s", err, path)
+	}
+
+	for i := range results {
+		if count := len(results[i].Loops); count > 0 {
+			results[i].iterated = results[i].Loops[count-1].Depth
+		}
+
+		results[i].Vars = scope.Vars
+		results[i].Loops = append(append([]Loop{}, loops...), results[i].Loops...)
+	}
+
+	return results, err
 }
 
-func get(context any, paths []string, stack []any) ([]Result, error) {
-	path := paths[0]
+// keepLoops drops the iteration levels whose items are no longer on the stack.
+func keepLoops(loops []Loop, stackLen int) []Loop {
+	kept := []Loop{}
 
-	if len(paths) == 1 {
-		if obj, ok := context.(map[string]any); ok {
-			return []Result{{Selected: obj[path], Stack: append(stack, obj[path])}}, nil
+	for _, loop := range loops {
+		if loop.Depth < stackLen {
+			kept = append(kept, loop)
 		}
+	}
 
-		return nil, nil
+	return kept
+}
+
+// refreshContext returns the element of the stack selected by $ and the stack below it,
+// ok is false if the index is out of the stack.
+func refreshContext(segment StackSegment, contexts []any) (any, []any, bool) {
+	index := len(contexts) - 1
+	below := index
+
+	switch {
+	case !segment.Indexed:
+	case segment.Index < 0:
+		index = len(contexts) + segment.Index
+		below = index + 1
+	default:
+		index = segment.Index
+		below = index
+	}
+
+	if index < 0 || index >= len(contexts) {
+		return nil, contexts, false
 	}
 
-	if path == "[]" || path == "*" {
-		if array, ok := context.([]map[string]any); ok {
-			return getArrayMap(array, paths, stack)
+	return contexts[index], contexts[:below], true
+}
+
+// stackError is returned when $ refers to an element out of the stack, a missing key in strict mode.
+func (e evaluator) stackError(path *Path, size int) error {
+	if e.strict {
+		return fmt.Errorf("%w: %s is out of the stack of %d elements", ErrMissingKey, path, size)
+	}
+
+	return fmt.Errorf("%w: %s is out of the stack of %d elements", ErrInvalidPath, path, size)
+}
+
+func (e evaluator) get(context any, segments []Segment, stack []any) ([]Result, error) {
+	switch segment := segments[0].(type) {
+	case DescentSegment:
+		return e.getDescendants(context, segments[1:], stack)
+	case WildcardSegment:
+		entries, ok := iterate(context, segment.Objects)
+		if !ok {
+			return nil, nil
 		}
 
-		if array, ok := context.([]any); ok {
-			return getArrayAny(array, paths, stack)
+		return e.getEntries(entries, segments[1:], stack, segment.Keys)
+	case IndexSegment, SliceSegment:
+		entries, ok := iterate(context, false)
+		if !ok {
+			return nil, nil
 		}
+
+		return e.getEntries(selectRange(entries, segment), segments[1:], stack, false)
+	case FilterSegment:
+		return e.getFiltered(context, segment.filter, segments[1:], stack)
+	case UnionSegment:
+		return e.getEntries(e.selectEntries(context, segment.Selectors), segments[1:], stack, false)
+	case KeySegment:
+		return e.getKey(context, segment.Key, segments, stack)
+	default:
+		return nil, fmt.Errorf("%w: unexpected segment %s", ErrInvalidPath, segment)
+	}
+}
+
+func (e evaluator) getKey(context any, key string, segments []Segment, stack []any) ([]Result, error) {
+	if e.strict && !has(context, key) {
+		return nil, fmt.Errorf("%w %s", ErrMissingKey, key)
 	}
 
-	if obj, ok := context.(map[string]any); ok {
-		return get(obj[path], paths[1:], append(stack, obj[path]))
+	if e.dialect == DialectRFC9535 && !has(context, key) {
+		return nil, nil
+	}
+
+	if value, ok := lookup(context, key); ok {
+		if len(segments) == 1 {
+			return []Result{{Selected: value, Stack: push(stack, value), Vars: nil, Loops: nil, iterated: 0}}, nil
+		}
+
+		return e.get(value, segments[1:], push(stack, value))
 	}
 
 	return nil, nil
 }
 
-func getArrayMap(array []map[string]any, paths []string, stack []any) ([]Result, error) {
+// getDescendants follows the path from the context and from each of its descendants, depth first.
+// Every traversed descendant is pushed on the stack, so the full chain of ancestors is kept.
+func (e evaluator) getDescendants(context any, segments []Segment, stack []any) ([]Result, error) {
 	allResults := []Result{}
 
-	for _, item := range array {
-		newstack := make([]any, len(stack)+1)
-		copy(newstack, stack)
-		newstack[len(stack)] = item
-
-		results, err := get(item, paths[1:], newstack)
+	// a key is only followed where it is defined, other segments select nothing on unsuitable values
+	if key, ok := segments[0].(KeySegment); !ok || has(context, key.Key) {
+		results, err := e.get(context, segments, stack)
 		if err != nil {
 			return nil, err
 		}
@@ -97,18 +218,14 @@ func getArrayMap(array []map[string]any, paths []string, stack []any) ([]Result,
 		allResults = append(allResults, results...)
 	}
 
-	return allResults, nil
-}
-
-func getArrayAny(array []any, paths []string, stack []any) ([]Result, error) {
-	allResults := []Result{}
+	entries, _ := iterate(context, true)
 
-	for _, item := range array {
-		newstack := make([]any, len(stack)+1)
-		copy(newstack, stack)
-		newstack[len(stack)] = item
+	for _, entry := range entries {
+		if isAncestor(entry.value, stack) {
+			return nil, fmt.Errorf("%w: %T contains itself", ErrCyclicContext, entry.value)
+		}
 
-		results, err := get(item, paths[1:], newstack)
+		results, err := e.getDescendants(entry.value, segments, push(stack, entry.value))
 		if err != nil {
 			return nil, err
 		}
@@ -119,111 +236,363 @@ func getArrayAny(array []any, paths []string, stack []any) ([]Result, error) {
 	return allResults, nil
 }
 
-func Develop(template string, contexts ...any) ([]ResultString, error) {
-	resultstrings := []ResultString{}
-	path, pathBegin, pathEnd := extractPath(template)
-
-	if len(path) == 0 {
-		return []ResultString{
-			{
-				Selected: template,
-				Stack:    contexts,
-			},
-		}, nil
-	}
-
-	results, err := Get(path, contexts...)
-	if err != nil {
-		return resultstrings, err
+// isAncestor tells if a value is already on the stack, a descent into it would never end.
+func isAncestor(value any, stack []any) bool {
+	id, ok := identity(value)
+	if !ok {
+		return false
 	}
 
-	for _, result := range results {
-		selectedString := strings.Builder{}
-		selectedString.WriteString(template[0:pathBegin])
-		selectedString.WriteString(toString(result.Selected))
-		selectedString.WriteString(template[pathEnd:])
-		resultstring := ResultString{
-			Selected: selectedString.String(),
-			Stack:    result.Stack,
+	for _, frame := range stack {
+		if frameID, ok := identity(frame); ok && frameID == id {
+			return true
 		}
-		resultstrings = append(resultstrings, resultstring)
 	}
 
-	return resultstrings, nil
+	return false
 }
 
-//nolint:gomnd
-func extractPath(template string) (string, int, int) {
-	var step, pathBegin, pathEnd int
+// unescape decodes backslash escape sequences, including \uXXXX code points. An unescaped quote is an error.
+//
+//nolint:cyclop
+func unescape(str string, quote rune) (string, error) {
+	result := strings.Builder{}
+	runes := []rune(str)
 
-	path := strings.Builder{}
+	for index := 0; index < len(runes); index++ {
+		char := runes[index]
 
-	for index, char := range template {
-		switch step {
-		case 0:
-			if char == '{' {
-				step = 1
-				pathBegin = index
-			}
-		case 1:
-			if char == '{' {
-				step = 2
-			} else {
-				step = 0
+		if quote != 0 && char == quote {
+			return "", fmt.Errorf("%w: unescaped quote in %s", errInvalidEscape, str)
+		}
+
+		if char != '\\' {
+			result.WriteRune(char)
+
+			continue
+		}
+
+		index++
+		if index == len(runes) {
+			return "", fmt.Errorf("%w: incomplete escape sequence in %s", errInvalidEscape, str)
+		}
+
+		switch runes[index] {
+		case 'b':
+			result.WriteRune('\b')
+		case 'f':
+			result.WriteRune('\f')
+		case 'n':
+			result.WriteRune('\n')
+		case 'r':
+			result.WriteRune('\r')
+		case 't':
+			result.WriteRune('\t')
+		case 'u':
+			if index+4 >= len(runes) {
+				return "", fmt.Errorf("%w: incomplete unicode escape in %s", errInvalidEscape, str)
 			}
-		case 2:
-			if char == '}' {
-				step = 3
-			} else {
-				path.WriteRune(char)
+
+			code, err := strconv.ParseUint(string(runes[index+1:index+5]), 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("%w: invalid unicode escape in %s", errInvalidEscape, str)
 			}
-		case 3:
-			if char == '}' {
-				pathEnd = index + 1
 
-				return path.String(), pathBegin, pathEnd
+			index += 4
+
+			// a high surrogate followed by a low surrogate encodes a code point outside of the basic plane (\uD83D\uDE00)
+			if utf16.IsSurrogate(rune(code)) && index+6 < len(runes) && runes[index+1] == '\\' && runes[index+2] == 'u' {
+				low, err := strconv.ParseUint(string(runes[index+3:index+7]), 16, 32)
+				if decoded := utf16.DecodeRune(rune(code), rune(low)); err == nil && decoded != unicode.ReplacementChar {
+					code = uint64(decoded)
+					index += 6
+				}
 			}
 
-			path.WriteRune('}')
-			path.WriteRune(char)
-
-			step = 2
-		}
-	}
-
-	return "", 0, 0
-}
-
-//nolint:gocyclop,cyclop
-func toString(v any) string {
-	switch vTyped := v.(type) {
-	case string:
-		return vTyped
-	case fmt.Stringer:
-		return vTyped.String()
-	case int:
-		return strconv.Itoa(vTyped)
-	case int64:
-		return strconv.FormatInt(vTyped, 10)
-	case int32:
-		return strconv.FormatInt(int64(vTyped), 10)
-	case int16:
-		return strconv.FormatInt(int64(vTyped), 10)
-	case int8:
-		return strconv.FormatInt(int64(vTyped), 10)
-	case uint:
-		return strconv.FormatUint(uint64(vTyped), 10)
-	case uint64:
-		return strconv.FormatUint(vTyped, 10)
-	case uint32:
-		return strconv.FormatUint(uint64(vTyped), 10)
-	case uint16:
-		return strconv.FormatUint(uint64(vTyped), 10)
-	case uint8:
-		return strconv.FormatUint(uint64(vTyped), 10)
-	case bool:
-		return strconv.FormatBool(vTyped)
+			result.WriteRune(rune(code))
+		default:
+			result.WriteRune(runes[index])
+		}
+	}
+
+	return result.String(), nil
+}
+
+func has(context any, key string) bool {
+	switch obj := context.(type) {
+	case map[string]any:
+		_, ok := obj[key]
+
+		return ok
+	case *OrderedMap:
+		_, ok := obj.Get(key)
+
+		return ok
 	default:
-		return fmt.Sprintf("%v", vTyped)
+		_, found, _ := reflectLookup(context, key)
+
+		return found
+	}
+}
+
+// lookup returns the value of the key if the context is an object (a map or a struct), missing keys have a nil value.
+func lookup(context any, key string) (any, bool) {
+	switch obj := context.(type) {
+	case map[string]any:
+		return obj[key], true
+	case *OrderedMap:
+		value, _ := obj.Get(key)
+
+		return value, true
+	default:
+		value, _, object := reflectLookup(context, key)
+
+		return value, object
+	}
+}
+
+type entry struct {
+	key   any
+	value any
+}
+
+// iterate lists the entries of an array, or of an object if withObjects is true.
+// Entries of an ordered map keep the document order, other maps are sorted by key.
+// Values of other types than the ones of the context readers are iterated by reflection.
+func iterate(context any, withObjects bool) ([]entry, bool) {
+	switch typed := context.(type) {
+	case []any:
+		entries := make([]entry, len(typed))
+		for index, item := range typed {
+			entries[index] = entry{key: index, value: item}
+		}
+
+		return entries, true
+	case []map[string]any:
+		entries := make([]entry, len(typed))
+		for index, item := range typed {
+			entries[index] = entry{key: index, value: item}
+		}
+
+		return entries, true
+	}
+
+	if !withObjects {
+		return reflectIterate(context, withObjects)
 	}
+
+	switch typed := context.(type) {
+	case *OrderedMap:
+		entries := make([]entry, typed.Len())
+		for index, key := range typed.Keys() {
+			value, _ := typed.Get(key)
+			entries[index] = entry{key: key, value: value}
+		}
+
+		return entries, true
+	case map[string]any:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		entries := make([]entry, len(keys))
+		for index, key := range keys {
+			entries[index] = entry{key: key, value: typed[key]}
+		}
+
+		return entries, true
+	}
+
+	return reflectIterate(context, withObjects)
+}
+
+// selectRange keeps the entries matching an index ([1], [-1]) or a slice ([start:end:step]) segment.
+func selectRange(entries []entry, segment Segment) []entry {
+	if indexSegment, ok := segment.(IndexSegment); ok {
+		index := indexSegment.Index
+		if index < 0 {
+			index += len(entries)
+		}
+
+		if index < 0 || index >= len(entries) {
+			return nil
+		}
+
+		return entries[index : index+1]
+	}
+
+	slice, _ := segment.(SliceSegment)
+	selected := []entry{}
+
+	for _, index := range sliceIndexes(len(entries), slice) {
+		selected = append(selected, entries[index])
+	}
+
+	return selected
+}
+
+// sliceIndexes computes the indexes selected by a slice, bounds are optional and can be negative.
+func sliceIndexes(length int, slice SliceSegment) []int {
+	step := 1
+	if slice.Step != nil {
+		step = *slice.Step
+	}
+
+	if step == 0 {
+		return nil
+	}
+
+	start, end := 0, length
+	if step < 0 {
+		start, end = length-1, -length-1
+	}
+
+	if slice.Start != nil {
+		start = *slice.Start
+	}
+
+	if slice.End != nil {
+		end = *slice.End
+	}
+
+	lower, upper := sliceBounds(length, start, end, step)
+	indexes := []int{}
+
+	if step > 0 {
+		for i := lower; i < upper; i += step {
+			indexes = append(indexes, i)
+		}
+	} else {
+		for i := upper; lower < i; i += step {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes
+}
+
+func sliceBounds(length, start, end, step int) (int, int) {
+	normalize := func(i int) int {
+		if i < 0 {
+			return length + i
+		}
+
+		return i
+	}
+
+	clamp := func(i, low, high int) int {
+		return min(max(i, low), high)
+	}
+
+	start, end = normalize(start), normalize(end)
+
+	if step > 0 {
+		return clamp(start, 0, length), clamp(end, 0, length)
+	}
+
+	return clamp(end, -1, length-1), clamp(start, -1, length-1)
+}
+
+// getFiltered keeps the items of a list, or the values of an object, matching a filter segment ([?(@.name=='id')]).
+func (e evaluator) getFiltered(context any, filter filterNode, segments []Segment, stack []any) ([]Result, error) {
+	entries, ok := iterate(context, true)
+	if !ok {
+		return nil, nil
+	}
+
+	return e.getEntries(e.filterEntries(entries, filter), segments, stack, false)
+}
+
+func (e evaluator) filterEntries(entries []entry, filter filterNode) []entry {
+	selected := []entry{}
+
+	for _, entry := range entries {
+		if holds(filter, entry.value, e.root) {
+			selected = append(selected, entry)
+		}
+	}
+
+	return selected
+}
+
+// selectEntries lists the entries selected by each selector of a union ([0, 2], ['a', 'b']), in the order of the
+// selectors, so that the union is a single iteration level.
+func (e evaluator) selectEntries(context any, selectors []Segment) []entry {
+	selected := []entry{}
+
+	for _, selector := range selectors {
+		switch selector := selector.(type) {
+		case KeySegment:
+			if has(context, selector.Key) {
+				value, _ := lookup(context, selector.Key)
+				selected = append(selected, entry{key: selector.Key, value: value})
+			}
+		case WildcardSegment:
+			entries, _ := iterate(context, true)
+			selected = append(selected, entries...)
+		case IndexSegment, SliceSegment:
+			entries, _ := iterate(context, false)
+			selected = append(selected, selectRange(entries, selector)...)
+		case FilterSegment:
+			entries, _ := iterate(context, true)
+			selected = append(selected, e.filterEntries(entries, selector.filter)...)
+		}
+	}
+
+	return selected
+}
+
+func (e evaluator) getEntries(entries []entry, segments []Segment, stack []any, selectKeys bool) ([]Result, error) {
+	allResults := []Result{}
+
+	for index, entry := range entries {
+		loop := newLoop(index, len(entries), entry.key, len(stack))
+
+		if selectKeys {
+			allResults = append(allResults, Result{
+				Selected: entry.key,
+				Stack:    push(stack, entry.value),
+				Vars:     nil,
+				Loops:    []Loop{loop},
+				iterated: 0,
+			})
+
+			continue
+		}
+
+		results, err := e.getItem(entry.value, segments, stack)
+		if err != nil {
+			return nil, err
+		}
+
+		// outer iteration levels come first
+		for i := range results {
+			results[i].Loops = append([]Loop{loop}, results[i].Loops...)
+		}
+
+		allResults = append(allResults, results...)
+	}
+
+	return allResults, nil
+}
+
+// getItem pushes an iterated item on the stack, the item is selected if there is no path left to follow.
+func (e evaluator) getItem(item any, segments []Segment, stack []any) ([]Result, error) {
+	if len(segments) == 0 {
+		return []Result{{Selected: item, Stack: push(stack, item), Vars: nil, Loops: nil, iterated: 0}}, nil
+	}
+
+	return e.get(item, segments, push(stack, item))
+}
+
+// push returns a copy of stack with item on top, developments must never share a backing array.
+func push(stack []any, item any) []any {
+	newstack := make([]any, len(stack)+1)
+	copy(newstack, stack)
+	newstack[len(stack)] = item
+
+	return newstack
 }
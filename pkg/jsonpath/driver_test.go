@@ -19,6 +19,7 @@
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/cgi-fr/emporte-piece/pkg/jsonpath"
@@ -87,4 +88,804 @@ func TestDevelopContext(t *testing.T) {
 	assert.Len(t, res, 2)
 	assert.Equal(t, "column_3.txt", res[0].Selected)
 	assert.Equal(t, "column_4.txt", res[1].Selected)
+
+	testdatas := []struct {
+		template string
+		strict   bool
+		expected error
+	}{
+		{"{{$[5].name}}", false, jsonpath.ErrInvalidPath},
+		{"{{$[-5].name}}", false, jsonpath.ErrInvalidPath},
+		{"{{$[4].name}}", true, jsonpath.ErrMissingKey},
+		{"{{$[-5].name}}", true, jsonpath.ErrMissingKey},
+	}
+
+	for _, td := range testdatas {
+		td := td
+		t.Run(fmt.Sprintf("%s strict=%v", td.template, td.strict), func(t *testing.T) {
+			t.Parallel()
+
+			_, err := jsonpath.NewDeveloper().WithStrict(td.strict).Develop(td.template, jsonpath.Scope{Stack: stack, Vars: nil, Loops: nil})
+			assert.ErrorIs(t, err, td.expected)
+		})
+	}
+
+	_, err = jsonpath.Develop("{{$.name}}")
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath, "empty stack")
+}
+
+func TestDevelopMultiplePaths(t *testing.T) {
+	t.Parallel()
+
+	root := map[string]any{
+		"env": "dev",
+		"tables": []any{
+			map[string]any{"name": "table_1"},
+			map[string]any{"name": "table_2"},
+		},
+		"schemas": []any{
+			map[string]any{"name": "public"},
+			map[string]any{"name": "private"},
+		},
+	}
+
+	res, err := jsonpath.Develop("{{env}}_{{$[-2].tables.[].name}}.yml", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "dev_table_1.yml", res[0].Selected)
+	assert.Equal(t, "dev_table_2.yml", res[1].Selected)
+	assert.Equal(t, []any{root, root["tables"], root["tables"].([]any)[1], "table_2"}, res[1].Stack) //nolint:forcetypeassert
+
+	res, err = jsonpath.Develop("{{schemas.[].name}}.{{tables.[].name}}.sql", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 4)
+	assert.Equal(t, "public.table_1.sql", res[0].Selected)
+	assert.Equal(t, "public.table_2.sql", res[1].Selected)
+	assert.Equal(t, "private.table_1.sql", res[2].Selected)
+	assert.Equal(t, "private.table_2.sql", res[3].Selected)
+
+	schemas, _ := root["schemas"].([]any)
+	tables, _ := root["tables"].([]any)
+	assert.Equal(t, []any{root, schemas, schemas[1], "private", tables, tables[0], "table_1"}, res[2].Stack)
+}
+
+func TestDevelopScalarArray(t *testing.T) {
+	t.Parallel()
+
+	tags := []any{"a", 2, true}
+	root := map[string]any{"tags": tags}
+
+	res, err := jsonpath.Develop("tag_{{tags.[]}}.txt", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+	assert.Equal(t, "tag_a.txt", res[0].Selected)
+	assert.Equal(t, "tag_2.txt", res[1].Selected)
+	assert.Equal(t, "tag_true.txt", res[2].Selected)
+	assert.Equal(t, []any{root, tags, "a"}, res[0].Stack)
+
+	res, err = jsonpath.Develop("{{tags.*}}", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+	assert.Equal(t, []any{root, tags, true}, res[2].Stack)
+}
+
+func TestDevelopMapEntries(t *testing.T) {
+	t.Parallel()
+
+	prod := map[string]any{"replicas": 3}
+	dev := map[string]any{"replicas": 1}
+	environments := jsonpath.NewOrderedMap()
+	environments.Set("prod", prod)
+	environments.Set("dev", dev)
+
+	root := map[string]any{"environments": environments}
+
+	res, err := jsonpath.Develop("{{environments.*~}}.yml", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "prod.yml", res[0].Selected)
+	assert.Equal(t, "dev.yml", res[1].Selected)
+	assert.Equal(t, []any{root, environments, dev}, res[1].Stack)
+
+	res, err = jsonpath.Develop("{{environments.*.replicas}}", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "3", res[0].Selected)
+	assert.Equal(t, []any{root, environments, prod, 3}, res[0].Stack)
+
+	// plain maps have no order, keys are sorted
+	res, err = jsonpath.Develop("{{environments.*~}}", map[string]any{"environments": map[string]any{"prod": prod, "dev": dev}})
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "dev", res[0].Selected)
+	assert.Equal(t, "prod", res[1].Selected)
+
+	_, err = jsonpath.Develop("{{environments.*~.replicas}}", root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+}
+
+func TestDevelopIndexAndSlice(t *testing.T) {
+	t.Parallel()
+
+	tables := []any{
+		map[string]any{"name": "table_1"},
+		map[string]any{"name": "table_2"},
+		map[string]any{"name": "table_3"},
+		map[string]any{"name": "table_4"},
+	}
+	root := map[string]any{"tables": tables}
+
+	testdatas := []struct {
+		template string
+		expected []string
+	}{
+		{"{{tables.[0].name}}", []string{"table_1"}},
+		{"{{tables.[-1].name}}", []string{"table_4"}},
+		{"{{tables.[4].name}}", []string{}},
+		{"{{tables.[1:3].name}}", []string{"table_2", "table_3"}},
+		{"{{tables.[:2].name}}", []string{"table_1", "table_2"}},
+		{"{{tables.[-2:].name}}", []string{"table_3", "table_4"}},
+		{"{{tables.[::2].name}}", []string{"table_1", "table_3"}},
+		{"{{tables.[::-1].name}}", []string{"table_4", "table_3", "table_2", "table_1"}},
+	}
+
+	for _, td := range testdatas {
+		td := td
+		t.Run(td.template, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := jsonpath.Develop(td.template, root)
+			assert.NoError(t, err)
+
+			selected := []string{}
+			for _, r := range res {
+				selected = append(selected, r.Selected)
+			}
+
+			assert.Equal(t, td.expected, selected)
+		})
+	}
+
+	res, err := jsonpath.Develop("{{tables.[-1].name}}", root)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []any{root, tables, tables[3], "table_4"}, res[0].Stack)
+}
+
+func TestDevelopFilter(t *testing.T) {
+	t.Parallel()
+
+	tables := []any{
+		map[string]any{"name": "customer", "masked": true, "rows": 1200, "columns": []any{
+			map[string]any{"name": "birth", "type": "date"},
+			map[string]any{"name": "email", "type": "string"},
+		}},
+		map[string]any{"name": "product", "masked": false, "rows": 80, "comment": nil},
+		map[string]any{"name": "order", "rows": 35000, "comment": "o.r.d.e.r"},
+	}
+	root := map[string]any{"tables": tables, "tags": []any{"a", "b", "c"}}
+
+	testdatas := []struct {
+		template string
+		expected []string
+	}{
+		{"{{tables.[?(@.masked==true)].name}}", []string{"customer"}},
+		{"{{tables.[?(@.masked)].name}}", []string{"customer", "product"}},
+		{"{{tables.[?(!@.masked)].name}}", []string{"order"}},
+		{"{{tables.[?(@.masked!=true)].name}}", []string{"product", "order"}},
+		{"{{tables.[?(@.rows >= 1200 && @.rows < 35000)].name}}", []string{"customer"}},
+		{"{{tables.[?(@.rows < 100 || @.name == 'order')].name}}", []string{"product", "order"}},
+		{"{{tables.[?(@.comment == 'o.r.d.e.r')].name}}", []string{"order"}},
+		{"{{tables.[?(@.name > \"n\")].name}}", []string{"product", "order"}},
+		{"{{tables.[].columns.[?(@.type=='date')].name}}", []string{"birth"}},
+		{"{{tables.[?(@.columns.[0].type=='date')].name}}", []string{"customer"}},
+		{"{{tags.[?(@!='b')]}}", []string{"a", "c"}},
+		{"{{tables.[?(@.comment == null)].name}}", []string{"customer", "product"}},
+		{"{{tables.[?(@.comment != null)].name}}", []string{"order"}},
+		{"{{tables.[?(@.comment)].name}}", []string{"order"}},
+	}
+
+	for _, td := range testdatas {
+		td := td
+		t.Run(td.template, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := jsonpath.Develop(td.template, root)
+			assert.NoError(t, err)
+
+			selected := []string{}
+			for _, r := range res {
+				selected = append(selected, r.Selected)
+			}
+
+			assert.Equal(t, td.expected, selected)
+		})
+	}
+
+	res, err := jsonpath.Develop("{{tables.[?(@.masked==true)].name}}", root)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []any{root, tables, tables[0], "customer"}, res[0].Stack)
+
+	_, err = jsonpath.Develop("{{tables.[?(@.masked==)].name}}", root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+}
+
+func TestDevelopRecursiveDescent(t *testing.T) {
+	t.Parallel()
+
+	column1 := map[string]any{"name": "column_1"}
+	column2 := map[string]any{"name": "column_2"}
+	column3 := map[string]any{"name": "column_3"}
+	columns1 := []any{column1, column2}
+	columns2 := []any{column3}
+	table1 := map[string]any{"name": "table_1", "columns": columns1}
+	table2 := map[string]any{"name": "table_2", "columns": columns2}
+	tables := []any{table1}
+	schema := map[string]any{"name": "public", "tables": tables}
+	schemas := []any{schema}
+	root := map[string]any{"schemas": schemas, "tables": []any{table2}}
+
+	res, err := jsonpath.Develop("{{..columns.[].name}}", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+	assert.Equal(t, "column_1", res[0].Selected)
+	assert.Equal(t, "column_2", res[1].Selected)
+	assert.Equal(t, "column_3", res[2].Selected)
+	assert.Equal(t, []any{root, schemas, schema, tables, table1, columns1, column1, "column_1"}, res[0].Stack)
+	assert.Equal(t, []any{root, root["tables"], table2, columns2, column3, "column_3"}, res[2].Stack)
+
+	res, err = jsonpath.Develop("{{schemas..[?(@.name=='column_2')].name}}", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, []any{root, schemas, schema, tables, table1, columns1, column2, "column_2"}, res[0].Stack)
+
+	_, err = jsonpath.Develop("{{schemas..}}", root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+}
+
+func TestDevelopQuotedKeys(t *testing.T) {
+	t.Parallel()
+
+	labels := map[string]any{"app.kubernetes.io/name": "ep", "my table": "t", "it's": "quote", "a.b": "dotted"}
+	root := map[string]any{"labels": labels}
+
+	testdatas := []struct {
+		template string
+		expected string
+	}{
+		{"{{labels.['app.kubernetes.io/name']}}", "ep"},
+		{"{{labels['app.kubernetes.io\\u002fname']}}", "ep"},
+		{`{{labels.["app.kubernetes.io/name"]}}`, "ep"},
+		{"{{labels.my table}}", "t"},
+		{"{{labels.['my table']}}", "t"},
+		{`{{labels.['it\'s']}}`, "quote"},
+		{`{{labels.a\.b}}`, "dotted"},
+	}
+
+	for _, td := range testdatas {
+		td := td
+		t.Run(td.template, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := jsonpath.Develop(td.template, root)
+
+			assert.NoError(t, err)
+			assert.Len(t, res, 1)
+			assert.Equal(t, td.expected, res[0].Selected)
+			assert.Equal(t, []any{root, labels, td.expected}, res[0].Stack)
+		})
+	}
+
+	_, err := jsonpath.Develop("{{labels.['app.kubernetes.io/name}}", root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+
+	_, err = jsonpath.Develop("{{labels.[name]}}", root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+
+	_, err = jsonpath.Develop(`{{labels.[?(@ == 'a\u12')]}}`, root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath, "invalid escape in a filter string")
+}
+
+func TestDevelopAlias(t *testing.T) {
+	t.Parallel()
+
+	column1 := map[string]any{"name": "column_1"}
+	column2 := map[string]any{"name": "column_2"}
+	columns := []any{column1, column2}
+	table := map[string]any{"name": "table_1", "columns": columns}
+	tables := []any{table}
+	root := map[string]any{"tables": tables, "project": "ep"}
+
+	res, err := jsonpath.Develop("{{tables.[].name as table}}", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "table_1", res[0].Selected)
+	assert.Equal(t, map[string]any{"table": table}, res[0].Vars)
+
+	res, err = jsonpath.DevelopScope("{{table.columns.[].name as col}}_{{col.name}}", res[0].Scope())
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "column_1_column_1", res[0].Selected)
+	assert.Equal(t, "column_2_column_2", res[1].Selected)
+	assert.Equal(t, map[string]any{"table": table, "col": column2}, res[1].Vars)
+	assert.Equal(t, []any{root, tables, table, "table_1", columns, column2, "column_2", "column_2"}, res[1].Stack)
+
+	// without iteration the selected value is bound
+	res, err = jsonpath.Develop("{{project as p}}-{{p}}", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "ep-ep", res[0].Selected)
+
+	// a missing or invalid alias is an error, " as " in a quoted key or a filter is not an alias
+	for _, template := range []string{"{{tables.[].name as}}", "{{project as 1bad}}", "{{project as a.b}}"} {
+		_, err = jsonpath.Develop(template, root)
+		assert.ErrorIs(t, err, jsonpath.ErrInvalidPath, template)
+	}
+
+	res, err = jsonpath.Develop("{{tables.[?(@.name != 'a as b')].name as t}}-{{t.name}}", root)
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "table_1-table_1", res[0].Selected)
+}
+
+func TestDevelopLoops(t *testing.T) {
+	t.Parallel()
+
+	scripts := []any{
+		map[string]any{"name": "init"},
+		map[string]any{"name": "tables"},
+		map[string]any{"name": "views"},
+	}
+	root := map[string]any{"scripts": scripts, "envs": map[string]any{"dev": 1, "prod": 2}}
+
+	res, err := jsonpath.Develop("{{@number%02d}}_{{scripts.[].name}}.sql", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+	assert.Equal(t, "01_init.sql", res[0].Selected)
+	assert.Equal(t, "02_tables.sql", res[1].Selected)
+	assert.Equal(t, "03_views.sql", res[2].Selected)
+	assert.Equal(t, []jsonpath.Loop{{Index: 2, Number: 3, Count: 3, First: false, Last: true, Key: 2, Depth: 2}}, res[2].Loops)
+
+	res, err = jsonpath.Develop("{{envs.*~}}-{{scripts.[1:].name}}-{{@[-2].index}}{{@index}}-{{@[0].key}}-{{@last}}", root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 4)
+	assert.Equal(t, "dev-tables-00-dev-false", res[0].Selected)
+	assert.Equal(t, "dev-views-01-dev-true", res[1].Selected)
+	assert.Equal(t, "prod-views-11-prod-true", res[3].Selected)
+
+	// iteration levels are kept across developments
+	res, err = jsonpath.DevelopScope("{{@[-2].number}}.{{$[-2].name}}", res[3].Scope())
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "2.views", res[0].Selected)
+
+	_, err = jsonpath.Develop("{{@index}}", root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+}
+
+func TestDevelopPipes(t *testing.T) {
+	t.Parallel()
+
+	root := map[string]any{"tables": []any{map[string]any{"name": "CUSTOMER"}, map[string]any{"name": "ORDER|LINE"}}}
+	developer := jsonpath.NewDeveloper().WithFuncs(map[string]any{"ToLower": strings.ToLower})
+
+	res, err := developer.Develop(`{{@number | printf "%03d"}}-{{tables.[].name | ToLower | printf "%s.yml"}}`, jsonpath.Scope{Stack: []any{root}})
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "001-customer.yml", res[0].Selected)
+	assert.Equal(t, "002-order|line.yml", res[1].Selected)
+	assert.Equal(t, []any{root, root["tables"], map[string]any{"name": "ORDER|LINE"}, "ORDER|LINE"}, res[1].Stack)
+
+	res, err = developer.Develop(`{{tables.[?(@.name=='ORDER|LINE' || @.name=='x')].name | ToLower}}`, jsonpath.Scope{Stack: []any{root}})
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "order|line", res[0].Selected)
+
+	_, err = jsonpath.Develop("{{tables.[].name | ToLower}}", root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+
+	// the parsed pipelines are reused, a developer with other functions parses them again
+	upper := developer.WithFuncs(map[string]any{"ToLower": strings.ToUpper})
+
+	for i := 0; i < 2; i++ {
+		res, err = developer.Develop(`{{tables.[0].name | ToLower}}`, jsonpath.Scope{Stack: []any{root}})
+		assert.NoError(t, err)
+		assert.Equal(t, "customer", res[0].Selected)
+
+		res, err = upper.Develop(`{{tables.[0].name | ToLower}}`, jsonpath.Scope{Stack: []any{root}})
+		assert.NoError(t, err)
+		assert.Equal(t, "CUSTOMER", res[0].Selected)
+	}
+
+	_, err = developer.Develop("{{tables.}}", jsonpath.Scope{Stack: []any{root}})
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+}
+
+func TestDevelopConditional(t *testing.T) {
+	t.Parallel()
+
+	features := map[string]any{"docker": true, "ci": false, "masking": []any{"customer"}, "sonar": ""}
+	root := map[string]any{"features": features}
+
+	testdatas := []struct {
+		template string
+		expected []string
+	}{
+		{"{{?features.docker}}Dockerfile", []string{"Dockerfile"}},
+		{"{{?features.ci}}.gitlab-ci.yml", []string{}},
+		{"{{?features.missing}}missing.txt", []string{}},
+		{"{{?features.sonar}}sonar.properties", []string{}},
+		{"{{?features.masking}}masking", []string{"masking"}},
+		{"{{?features.masking.[]}}mask_{{$[-1]}}.yml", []string{"mask_customer.yml"}},
+	}
+
+	for _, td := range testdatas {
+		td := td
+		t.Run(td.template, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := jsonpath.Develop(td.template, root)
+			assert.NoError(t, err)
+
+			selected := []string{}
+			for _, r := range res {
+				selected = append(selected, r.Selected)
+			}
+
+			assert.Equal(t, td.expected, selected)
+		})
+	}
+
+	res, err := jsonpath.Develop("{{?features.docker}}Dockerfile", root)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []any{root, features, true}, res[0].Stack)
+}
+
+func TestDevelopDefault(t *testing.T) {
+	t.Parallel()
+
+	root := map[string]any{"tables": []any{map[string]any{"name": "customer"}, map[string]any{"name": nil}, map[string]any{}}}
+
+	res, err := jsonpath.Develop(`{{tables.[].name ?: "unnamed"}}.yml`, root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+	assert.Equal(t, "customer.yml", res[0].Selected)
+	assert.Equal(t, "unnamed.yml", res[1].Selected)
+	assert.Equal(t, "unnamed.yml", res[2].Selected)
+	assert.Equal(t, []any{root, root["tables"], map[string]any{}, "unnamed"}, res[2].Stack)
+
+	res, err = jsonpath.Develop(`{{project.version ?: 1 as version}}-{{version}}`, root)
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "1-1", res[0].Selected)
+
+	_, err = jsonpath.Develop(`{{name ?: unnamed}}`, root)
+
+	assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+}
+
+func TestDevelopStrict(t *testing.T) {
+	t.Parallel()
+
+	root := map[string]any{"tables": []any{map[string]any{"name": "customer"}, map[string]any{"label": "order"}}}
+	developer := jsonpath.NewDeveloper().WithStrict(true)
+
+	_, err := developer.Develop("{{tables.[].name}}.yml", jsonpath.Scope{Stack: []any{root}})
+
+	assert.ErrorIs(t, err, jsonpath.ErrMissingKey)
+	assert.ErrorContains(t, err, "missing key name in tables.[].name")
+
+	res, err := developer.Develop(`{{tables.[].name ?: "unnamed"}}{{?tables.[0].label}}.yml`, jsonpath.Scope{Stack: []any{root}})
+
+	assert.NoError(t, err)
+	assert.Len(t, res, 0)
+
+	res, err = developer.Develop(`{{tables.[0].name}}.yml`, jsonpath.Scope{Stack: []any{root}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "customer.yml", res[0].Selected)
+
+	res, err = jsonpath.Develop("{{tables.[].name}}.yml", root)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "<nil>.yml", res[1].Selected)
+}
+
+func TestDevelopReflection(t *testing.T) {
+	t.Parallel()
+
+	type column struct {
+		Name    string `json:"name"`
+		Type    string `yaml:"type"`
+		Comment string `json:"-"`
+	}
+
+	type table struct {
+		Name    string
+		Columns []column `json:"columns,omitempty"`
+	}
+
+	type schema struct {
+		table
+		Tables []*table
+		Labels map[string]string
+		Matrix [2][]int
+	}
+
+	root := &schema{
+		table: table{Name: "public", Columns: nil},
+		Tables: []*table{
+			{Name: "customer", Columns: []column{{Name: "id", Type: "int", Comment: ""}, {Name: "birth", Type: "date", Comment: ""}}},
+			nil,
+		},
+		Labels: map[string]string{"owner": "dba", "env": "dev"},
+		Matrix: [2][]int{{1, 2}, {3}},
+	}
+
+	testdatas := []struct {
+		template string
+		expected []string
+	}{
+		{"{{Name}}", []string{"public"}},
+		{"{{Tables.[].Name}}", []string{"customer"}},
+		{"{{Tables.[0].columns.[?(@.type=='date')].name}}", []string{"birth"}},
+		{"{{Tables.[0].columns.[0].Comment}}", []string{"<nil>"}},
+		{"{{Labels.*~}}={{$[-1]}}", []string{"env=dev", "owner=dba"}},
+		{"{{Labels.owner}}", []string{"dba"}},
+		{"{{Matrix.[].[]}}", []string{"1", "2", "3"}},
+		{"{{..name}}", []string{"id", "birth"}},
+	}
+
+	for _, td := range testdatas {
+		td := td
+		t.Run(td.template, func(t *testing.T) {
+			t.Parallel()
+
+			res, err := jsonpath.Develop(td.template, root)
+			assert.NoError(t, err)
+
+			selected := []string{}
+			for _, r := range res {
+				selected = append(selected, r.Selected)
+			}
+
+			assert.Equal(t, td.expected, selected)
+		})
+	}
+
+	_, err := jsonpath.NewDeveloper().WithStrict(true).Develop("{{Tables.[].Name}}", jsonpath.Scope{Stack: []any{root}})
+
+	assert.ErrorIs(t, err, jsonpath.ErrMissingKey)
+
+	// templates receive the same names as path expressions
+	plain := jsonpath.Unordered(root.Tables[0])
+	assert.Equal(t, map[string]any{"Name": "customer", "columns": []any{
+		map[string]any{"name": "id", "type": "int"},
+		map[string]any{"name": "birth", "type": "date"},
+	}}, plain)
+
+	// the keys of a typed map are looked up directly
+	type env string
+
+	res, err := jsonpath.Develop("{{prod}}", map[env]int{"dev": 1, "prod": 3})
+	assert.NoError(t, err)
+	assert.Equal(t, "3", res[0].Selected)
+
+	// values containing themselves are an error, not an endless recursion
+	type node struct {
+		Name     string  `json:"name"`
+		Parent   *node   `json:"parent"`
+		Children []*node `json:"children"`
+	}
+
+	parent := &node{Name: "schema", Parent: nil, Children: nil}
+	parent.Children = []*node{{Name: "customer", Parent: parent, Children: nil}}
+
+	_, err = jsonpath.Plain(parent)
+	assert.ErrorIs(t, err, jsonpath.ErrCyclicContext)
+
+	_, err = jsonpath.Normalize(*parent)
+	assert.ErrorIs(t, err, jsonpath.ErrCyclicContext)
+
+	_, err = jsonpath.Develop("{{..name}}", parent)
+	assert.ErrorIs(t, err, jsonpath.ErrCyclicContext)
+
+	res, err = jsonpath.Develop("{{children.[].name}}", parent)
+	assert.NoError(t, err)
+	assert.Equal(t, "customer", res[0].Selected)
+
+	// a value shared by several parents is not a cycle
+	shared := &node{Name: "id", Parent: nil, Children: nil}
+	normalized, err := jsonpath.Normalize([]*node{shared, shared})
+	assert.NoError(t, err)
+	assert.Len(t, normalized, 2)
+}
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	path, err := jsonpath.Compile("$.tables.[?(@.name=='customer')].columns.[1:].name")
+	assert.NoError(t, err)
+	assert.Equal(t, "[$ tables [?(@.name=='customer')] columns [1:] name]", fmt.Sprint(path.Segments()))
+
+	context := map[string]any{"tables": []any{
+		map[string]any{"name": "customer", "columns": []any{map[string]any{"name": "id"}, map[string]any{"name": "birth"}}},
+		map[string]any{"name": "order", "columns": []any{map[string]any{"name": "id"}}},
+	}}
+
+	for i := 0; i < 2; i++ {
+		res, err := path.Evaluate(context)
+		assert.NoError(t, err)
+		assert.Len(t, res, 1)
+		assert.Equal(t, "birth", res[0].Selected)
+	}
+
+	testdatas := []struct {
+		expression string
+		column     int
+	}{
+		{"tables.[0", 8},
+		{"tables.['name", 9},
+		{"tables.[x]", 8},
+		{"tables.name]", 12},
+		{"tables.[?(@.name=='id' &&)]", 26},
+		{"tables.$", 8},
+		{"tables..", 9},
+		{"labels.*~.name", 8},
+		{"", 1},
+		{".", 1},
+		{"tables.", 8},
+		{"tables..name.", 14},
+	}
+
+	for _, td := range testdatas {
+		td := td
+		t.Run(td.expression, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := jsonpath.Compile(td.expression)
+
+			var syntaxError *jsonpath.SyntaxError
+
+			assert.ErrorIs(t, err, jsonpath.ErrInvalidPath)
+			assert.ErrorAs(t, err, &syntaxError)
+			assert.Equal(t, td.column, syntaxError.Column)
+		})
+	}
+}
+
+//nolint:lll
+func TestCompileCache(t *testing.T) {
+	t.Parallel()
+
+	// paths built from the data are evicted from the cache of compiled paths, their results stay the same
+	context := map[string]any{}
+	for i := 0; i < 3000; i++ {
+		context[fmt.Sprintf("key%d", i)] = i
+	}
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 3000; i++ {
+			res, err := jsonpath.Get(fmt.Sprintf("key%d", i), context)
+			assert.NoError(t, err)
+			assert.Equal(t, i, res[0].Selected)
+		}
+	}
+}
+
+func TestRFC9535(t *testing.T) {
+	t.Parallel()
+
+	context := map[string]any{"store": map[string]any{
+		"book": []any{
+			map[string]any{"category": "reference", "author": "Nigel Rees", "title": "Sayings", "price": 8.95},
+			map[string]any{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword", "price": 12.99, "isbn": nil},
+			map[string]any{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "price": 8.99, "isbn": "0-553"},
+		},
+		"bicycle": map[string]any{"color": "red", "price": 399},
+	}}
+
+	testdatas := []struct {
+		expression string
+		expected   []any
+	}{
+		{"$.store.book[*].author", []any{"Nigel Rees", "Evelyn Waugh", "Herman Melville"}},
+		{"$..author", []any{"Nigel Rees", "Evelyn Waugh", "Herman Melville"}},
+		{"$.store.bicycle.*", []any{"red", 399}},
+		{"$..book[-1].title", []any{"Moby Dick"}},
+		{"$.store.book[0, 2].title", []any{"Sayings", "Moby Dick"}},
+		{"$.store.book[:2].title", []any{"Sayings", "Sword"}},
+		{"$.store.book[::-1].title", []any{"Moby Dick", "Sword", "Sayings"}},
+		{"$.store['bicycle', 'missing']['color']", []any{"red"}},
+		{"$.store.book[?@.isbn].title", []any{"Sword", "Moby Dick"}},
+		{"$.store.book[?@.isbn == null].title", []any{"Sword"}},
+		{"$.store.book[?@.price < 10 && !(@.category == 'fiction')].title", []any{"Sayings"}},
+		{"$.store.book[?@.price < $.store.bicycle.price].price", []any{8.95, 12.99, 8.99}},
+		{"$.store.book[?length(@.title) > 5].title", []any{"Sayings", "Moby Dick"}},
+		{"$.store.book[?count(@.*) == 5].title", []any{"Sword", "Moby Dick"}},
+		{"$.store.book[?match(@.author, 'N.*')].title", []any{"Sayings"}},
+		{"$.store.book[?search(@.author, 'Mel')].title", []any{"Moby Dick"}},
+		{"$.store.book[?value(@..isbn) == '0-553'].title", []any{"Moby Dick"}},
+		{"$.store.missing", []any{}},
+	}
+
+	for _, td := range testdatas {
+		td := td
+		t.Run(td.expression, func(t *testing.T) {
+			t.Parallel()
+
+			path, err := jsonpath.CompileRFC9535(td.expression)
+			assert.NoError(t, err)
+
+			res, err := path.Evaluate(context)
+			assert.NoError(t, err)
+
+			selected := []any{}
+			for _, r := range res {
+				selected = append(selected, r.Selected)
+			}
+
+			assert.Equal(t, td.expected, selected)
+		})
+	}
+
+	for _, expression := range []string{"tables.[].name", "$[", "$.a[01]", "$.a.-b", "$.a[?@.* == 1]", "$.a[?1]", "$.a[?unknown(@)]", "$.a[?!@.b == 1]"} {
+		_, err := jsonpath.CompileRFC9535(expression)
+		assert.ErrorIs(t, err, jsonpath.ErrInvalidPath, expression)
+	}
+
+	res, err := jsonpath.NewDeveloper().WithDialect(jsonpath.DialectRFC9535).
+		Develop("{{?$.store.book[?@.price < 10] as book}}{{book.title}}_{{@[0].number}}", jsonpath.Scope{Stack: []any{context}})
+	assert.NoError(t, err)
+
+	selected := []string{}
+	for _, r := range res {
+		selected = append(selected, r.Selected)
+	}
+
+	assert.Equal(t, []string{"Sayings_1", "Moby Dick_2"}, selected)
+
+	// patterns built from the data are evicted from the cache of regular expressions
+	items := []any{}
+	for i := 0; i < 600; i++ {
+		items = append(items, map[string]any{"name": fmt.Sprintf("v%d", i), "pattern": fmt.Sprintf("v%d", i)})
+	}
+
+	for round := 0; round < 2; round++ {
+		path, err := jsonpath.CompileRFC9535("$.items[?match(@.name, @.pattern)].name")
+		assert.NoError(t, err)
+
+		results, err := path.Evaluate(map[string]any{"items": items})
+		assert.NoError(t, err)
+		assert.Len(t, results, 600)
+	}
 }
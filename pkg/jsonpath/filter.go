@@ -0,0 +1,525 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package jsonpath
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// filterNode is a node of a filter expression ([?(@.type=='date')]) evaluated on each item of an iteration,
+// the root is the value selected by $ in RFC 9535 filters.
+type filterNode interface {
+	evaluate(item any, root any) filterValue
+}
+
+type filterValue struct {
+	value  any
+	exists bool
+}
+
+// holds tests a node in a boolean context, a path relative to the current item is an existence test:
+// the value must be present and not null, or only present in RFC 9535 filters.
+func holds(node filterNode, item any, root any) bool {
+	value := node.evaluate(item, root)
+
+	if current, ok := node.(filterCurrent); ok {
+		return value.exists && (value.value != nil || current.dialect == DialectRFC9535)
+	}
+
+	b, _ := value.value.(bool)
+
+	return b
+}
+
+type filterLiteral struct {
+	value any
+}
+
+func (n filterLiteral) evaluate(_ any, _ any) filterValue {
+	return filterValue{value: n.value, exists: true}
+}
+
+// filterCurrent selects a value relative to the current item (@), or to the root ($) in RFC 9535 filters.
+// A missing value is null, or does not exist in RFC 9535 filters.
+type filterCurrent struct {
+	segments []Segment
+	absolute bool
+	dialect  Dialect
+}
+
+func (n filterCurrent) evaluate(item any, root any) filterValue {
+	nodes := n.nodes(item, root)
+
+	if n.dialect == DialectRFC9535 {
+		if len(nodes) == 0 {
+			return filterValue{value: nil, exists: false}
+		}
+
+		return filterValue{value: nodes[0], exists: true}
+	}
+
+	for _, node := range nodes {
+		if node != nil {
+			return filterValue{value: node, exists: true}
+		}
+	}
+
+	return filterValue{value: nil, exists: true}
+}
+
+// nodes returns all the values selected by the path.
+func (n filterCurrent) nodes(item any, root any) []any {
+	if n.absolute {
+		item = root
+	}
+
+	if len(n.segments) == 0 {
+		return []any{item}
+	}
+
+	results, err := evaluator{strict: false, root: root, dialect: n.dialect}.get(item, n.segments, nil)
+	if err != nil {
+		return nil
+	}
+
+	nodes := make([]any, len(results))
+	for i, result := range results {
+		nodes[i] = result.Selected
+	}
+
+	return nodes
+}
+
+type filterNot struct {
+	node filterNode
+}
+
+func (n filterNot) evaluate(item any, root any) filterValue {
+	return filterValue{value: !holds(n.node, item, root), exists: true}
+}
+
+type filterLogical struct {
+	operator    string
+	left, right filterNode
+}
+
+func (n filterLogical) evaluate(item any, root any) filterValue {
+	left := holds(n.left, item, root)
+
+	if n.operator == "&&" {
+		return filterValue{value: left && holds(n.right, item, root), exists: true}
+	}
+
+	return filterValue{value: left || holds(n.right, item, root), exists: true}
+}
+
+type filterComparison struct {
+	operator    string
+	left, right filterNode
+}
+
+func (n filterComparison) evaluate(item any, root any) filterValue {
+	return filterValue{value: compare(n.operator, n.left.evaluate(item, root), n.right.evaluate(item, root)), exists: true}
+}
+
+//nolint:cyclop
+func compare(operator string, left, right filterValue) bool {
+	switch operator {
+	case "==":
+		return equals(left, right)
+	case "!=":
+		return !equals(left, right)
+	}
+
+	if !left.exists || !right.exists {
+		return false
+	}
+
+	leftNumber, leftIsNumber := toFloat(left.value)
+	rightNumber, rightIsNumber := toFloat(right.value)
+
+	if leftIsNumber && rightIsNumber {
+		switch operator {
+		case "<":
+			return leftNumber < rightNumber
+		case "<=":
+			return leftNumber <= rightNumber
+		case ">":
+			return leftNumber > rightNumber
+		case ">=":
+			return leftNumber >= rightNumber
+		}
+	}
+
+	leftString, leftIsString := left.value.(string)
+	rightString, rightIsString := right.value.(string)
+
+	if leftIsString && rightIsString {
+		switch operator {
+		case "<":
+			return leftString < rightString
+		case "<=":
+			return leftString <= rightString
+		case ">":
+			return leftString > rightString
+		case ">=":
+			return leftString >= rightString
+		}
+	}
+
+	return false
+}
+
+func equals(left, right filterValue) bool {
+	if !left.exists || !right.exists {
+		return left.exists == right.exists
+	}
+
+	leftNumber, leftIsNumber := toFloat(left.value)
+	rightNumber, rightIsNumber := toFloat(right.value)
+
+	if leftIsNumber && rightIsNumber {
+		return leftNumber == rightNumber
+	}
+
+	return reflect.DeepEqual(Unordered(left.value), Unordered(right.value))
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := reflect.ValueOf(value); v.Kind() { //nolint:exhaustive
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// filterParser is a recursive descent parser for filter expressions.
+//
+//	or         := and ( '||' and )*
+//	and        := unary ( '&&' unary )*
+//	unary      := '!' unary | '(' or ')' | comparison
+//	comparison := operand ( ( '==' | '!=' | '<' | '<=' | '>' | '>=' ) operand )?
+//	operand    := '@' path | string | number | true | false | null
+//
+// Errors report the column in the whole path expression, the filter starts after offset runes.
+// In the RFC 9535 dialect, the parser also reads the queries themselves, see rfc9535.go.
+type filterParser struct {
+	input      []rune
+	pos        int
+	expression string
+	offset     int
+	dialect    Dialect
+}
+
+func parseFilter(expression string, filter string, offset int) (filterNode, error) {
+	parser := &filterParser{input: []rune(filter), pos: 0, expression: expression, offset: offset, dialect: DialectEmportePiece}
+
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skipSpaces()
+
+	if parser.pos < len(parser.input) {
+		return nil, parser.errorf("unexpected character %q", parser.input[parser.pos])
+	}
+
+	return node, nil
+}
+
+// parseLiteral parses a string, number, boolean or null literal.
+func parseLiteral(expression string) (any, error) {
+	parser := &filterParser{input: []rune(expression), pos: 0, expression: expression, offset: 0, dialect: DialectEmportePiece}
+
+	node, err := parser.parseOperand()
+	parser.skipSpaces()
+
+	literal, ok := node.(filterLiteral)
+	if err != nil || !ok || parser.pos < len(parser.input) {
+		return nil, fmt.Errorf("%w: invalid literal %s", ErrInvalidPath, expression)
+	}
+
+	return literal.value, nil
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	message := fmt.Sprintf(format, args...)
+	if p.dialect == DialectEmportePiece {
+		message = fmt.Sprintf("filter [?%s]: %s", string(p.input), message)
+	}
+
+	return &SyntaxError{
+		Expression: p.expression,
+		Column:     p.offset + p.pos + 1,
+		Message:    message,
+	}
+}
+
+func (p *filterParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *filterParser) peek(token string) bool {
+	p.skipSpaces()
+
+	return strings.HasPrefix(string(p.input[p.pos:]), token)
+}
+
+func (p *filterParser) consume(token string) bool {
+	if p.peek(token) {
+		p.pos += len([]rune(token))
+
+		return true
+	}
+
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = filterLogical{operator: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = filterLogical{operator: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.peek("!") && !p.peek("!=") {
+		p.pos++
+		parenthesized := p.peek("(")
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := node.(filterComparison); ok && !parenthesized && p.dialect == DialectRFC9535 {
+			return nil, p.errorf("a comparison must be in parenthesis to be negated")
+		}
+
+		return filterNot{node: node}, nil
+	}
+
+	if p.consume("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.consume(")") {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(operator) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			if p.dialect == DialectRFC9535 && (!isComparable(left) || !isComparable(right)) {
+				return nil, p.errorf("only literals, singular queries and value functions can be compared")
+			}
+
+			return filterComparison{operator: operator, left: left, right: right}, nil
+		}
+	}
+
+	if p.dialect == DialectRFC9535 && !isTestable(left) {
+		return nil, p.errorf("only queries and logical functions can be tested")
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseOperand() (filterNode, error) {
+	p.skipSpaces()
+
+	if p.pos >= len(p.input) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	switch char := p.input[p.pos]; {
+	case (char == '@' || char == '$') && p.dialect == DialectRFC9535:
+		return p.parseQuery()
+	case unicode.IsLower(char) && p.dialect == DialectRFC9535 && p.isFunction():
+		return p.parseFunction()
+	case char == '@':
+		return p.parseCurrent()
+	case char == '\'' || char == '"':
+		value, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+
+		return filterLiteral{value: value}, nil
+	case char == '-' || unicode.IsDigit(char):
+		return p.parseNumber()
+	}
+
+	for literal, value := range map[string]any{"true": true, "false": false, "null": nil} {
+		if p.consume(literal) {
+			return filterLiteral{value: value}, nil
+		}
+	}
+
+	return nil, p.errorf("unexpected character %q", p.input[p.pos])
+}
+
+// parseCurrent reads a path relative to the current item, up to the next operator outside of brackets and quotes.
+func (p *filterParser) parseCurrent() (filterNode, error) {
+	begin := p.pos + 1
+	depth := 0
+	quote := rune(0)
+
+	for p.pos++; p.pos < len(p.input); p.pos++ {
+		char := p.input[p.pos]
+
+		switch {
+		case quote != 0:
+			if char == '\\' {
+				p.pos++
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+		case char == '[':
+			depth++
+		case char == ']':
+			depth--
+		case depth == 0 && (unicode.IsSpace(char) || strings.ContainsRune("=!<>&|()", char)):
+			return p.newFilterCurrent(begin)
+		}
+	}
+
+	return p.newFilterCurrent(begin)
+}
+
+// newFilterCurrent compiles the path of the current item between begin and the position of the parser.
+func (p *filterParser) newFilterCurrent(begin int) (filterNode, error) {
+	path := string(p.input[begin:p.pos])
+	if strings.HasPrefix(path, ".") {
+		path = path[1:]
+		begin++
+	}
+
+	if path == "" {
+		return filterCurrent{segments: nil, absolute: false, dialect: DialectEmportePiece}, nil
+	}
+
+	segments, err := compileSegments(p.expression, path, p.offset+begin, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterCurrent{segments: segments, absolute: false, dialect: DialectEmportePiece}, nil
+}
+
+func (p *filterParser) parseString() (string, error) {
+	quote := p.input[p.pos]
+	begin := p.pos + 1
+
+	for p.pos++; p.pos < len(p.input); p.pos++ {
+		switch p.input[p.pos] {
+		case '\\':
+			p.pos++
+		case quote:
+			p.pos++
+
+			str, err := unescape(string(p.input[begin:p.pos-1]), quote)
+			if err != nil {
+				return "", p.errorf("%v", err)
+			}
+
+			return str, nil
+		}
+	}
+
+	return "", p.errorf("unterminated string")
+}
+
+func (p *filterParser) parseNumber() (filterNode, error) {
+	begin := p.pos
+
+	for p.pos++; p.pos < len(p.input); p.pos++ {
+		char := p.input[p.pos]
+		if !unicode.IsDigit(char) && !strings.ContainsRune(".eE+-", char) {
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(string(p.input[begin:p.pos]), 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", string(p.input[begin:p.pos]))
+	}
+
+	return filterLiteral{value: number}, nil
+}
@@ -17,12 +17,145 @@
 
 package jsonpath
 
+import "fmt"
+
 type Result struct {
 	Selected any
 	Stack    []any
+	Vars     map[string]any
+	Loops    []Loop
+
+	iterated int // position in the stack of the innermost item iterated by the path, 0 if none
+}
+
+// item returns the innermost iterated item, or the selected value if the path did not iterate.
+func (r Result) item() any {
+	if r.iterated == 0 {
+		return r.Selected
+	}
+
+	return r.Stack[r.iterated]
 }
 
 type ResultString struct {
 	Selected string
 	Stack    []any
+	Vars     map[string]any
+	Loops    []Loop
+}
+
+func (r ResultString) Scope() Scope {
+	return Scope{Stack: r.Stack, Vars: r.Vars, Loops: r.Loops}
+}
+
+// Scope is the state in which paths are evaluated: the stack, the variables bound by aliases
+// and the iteration levels that produced the stack.
+type Scope struct {
+	Stack []any
+	Vars  map[string]any
+	Loops []Loop
+}
+
+// Loop describes an iteration level, Depth is the position of the iterated item in the stack.
+type Loop struct {
+	Index  int
+	Number int
+	Count  int
+	First  bool
+	Last   bool
+	Key    any
+	Depth  int
+}
+
+func newLoop(index int, count int, key any, depth int) Loop {
+	return Loop{
+		Index:  index,
+		Number: index + 1,
+		Count:  count,
+		First:  index == 0,
+		Last:   index == count-1,
+		Key:    key,
+		Depth:  depth,
+	}
+}
+
+// OrderedMap is a map that remembers the insertion order of its keys,
+// it is used to iterate over the entries of an object in the order of the document.
+type OrderedMap struct {
+	keys   []string
+	values map[string]any
+	plain  map[string]any
+}
+
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{
+		keys:   []string{},
+		values: map[string]any{},
+		plain:  nil,
+	}
+}
+
+func (m *OrderedMap) Set(key string, value any) {
+	if _, exists := m.values[key]; !exists {
+		m.keys = append(m.keys, key)
+	}
+
+	m.values[key] = value
+	m.plain = nil
+}
+
+func (m *OrderedMap) Get(key string) (any, bool) {
+	value, ok := m.values[key]
+
+	return value, ok
+}
+
+func (m *OrderedMap) Keys() []string {
+	return m.keys
+}
+
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// Map returns the content as a plain map, usable by text/template. The result is cached and must not be modified.
+func (m *OrderedMap) Map() map[string]any {
+	if m.plain == nil {
+		m.plain = make(map[string]any, len(m.values))
+		for key, value := range m.values {
+			m.plain[key] = Unordered(value)
+		}
+	}
+
+	return m.plain
+}
+
+func (m *OrderedMap) String() string {
+	return fmt.Sprintf("%v", m.Map())
+}
+
+// Unordered replaces recursively all ordered maps in value by plain maps, and the other Go values (structs, typed maps
+// and slices, pointers) by plain maps and slices keyed like path expressions, so that templates use the same names.
+// It returns nil for a value containing itself, see Plain.
+func Unordered(value any) any {
+	result, _ := Plain(value)
+
+	return result
+}
+
+// Plain is like Unordered, but returns ErrCyclicContext if the value contains itself.
+func Plain(value any) (any, error) {
+	result, _, err := newConverter(false).convert(value)
+
+	return result, err
+}
+
+// Normalize converts the Go values of a context (structs, typed maps and slices, pointers) to the types of the context
+// readers: ordered maps keyed like path expressions, in the order they are iterated, and slices of any. A normalized
+// context is converted once for text/template, instead of on every generation. It returns ErrCyclicContext if the
+// value contains itself.
+func Normalize(value any) (any, error) {
+	result, _, err := newConverter(true).convert(value)
+
+	return result, err
 }
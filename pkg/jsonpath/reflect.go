@@ -0,0 +1,436 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package jsonpath
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The functions of this file traverse arbitrary Go values by reflection: maps of any key type, slices, arrays,
+// pointers and structs. They are used when a context is not made of the types produced by the context readers.
+
+// indirect follows pointers and interfaces, the result is invalid for a nil pointer or interface.
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+
+		value = value.Elem()
+	}
+
+	return value
+}
+
+// interfaceOf returns the value held by a reflected value, nil for an invalid or nil value.
+func interfaceOf(value reflect.Value) any {
+	if !value.IsValid() || !value.CanInterface() {
+		return nil
+	}
+
+	switch value.Kind() { //nolint:exhaustive
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+	}
+
+	return value.Interface()
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// reflectLookup returns the value of a key in a map or a struct, found is false if the key does not exist
+// and object is false if the value is neither a map nor a struct.
+func reflectLookup(context any, key string) (value any, found bool, object bool) {
+	obj := indirect(reflect.ValueOf(context))
+
+	switch obj.Kind() { //nolint:exhaustive
+	case reflect.Map:
+		// string keys are printed as is, unless they implement fmt.Stringer
+		if keyType := obj.Type().Key(); keyType.Kind() == reflect.String && !keyType.Implements(stringerType) {
+			value := obj.MapIndex(reflect.ValueOf(key).Convert(keyType))
+
+			return interfaceOf(value), value.IsValid(), true
+		}
+
+		for _, mapKey := range obj.MapKeys() {
+			if fmt.Sprint(interfaceOf(mapKey)) == key {
+				return interfaceOf(obj.MapIndex(mapKey)), true, true
+			}
+		}
+
+		return nil, false, true
+	case reflect.Struct:
+		for _, field := range structFields(obj) {
+			if field.name == key {
+				return interfaceOf(field.value), true, true
+			}
+		}
+
+		return nil, false, true
+	default:
+		return nil, false, false
+	}
+}
+
+// reflectIterate lists the entries of a slice or an array, or of a map or a struct if withObjects is true.
+// Maps are sorted by key, structs keep the order of declaration of their fields.
+func reflectIterate(context any, withObjects bool) ([]entry, bool) {
+	obj := indirect(reflect.ValueOf(context))
+
+	switch obj.Kind() { //nolint:exhaustive
+	case reflect.Slice, reflect.Array:
+		entries := make([]entry, obj.Len())
+		for index := range entries {
+			entries[index] = entry{key: index, value: interfaceOf(obj.Index(index))}
+		}
+
+		return entries, true
+	case reflect.Map:
+		if !withObjects {
+			return nil, false
+		}
+
+		entries := make([]entry, 0, obj.Len())
+		for _, mapKey := range obj.MapKeys() {
+			entries = append(entries, entry{key: interfaceOf(mapKey), value: interfaceOf(obj.MapIndex(mapKey))})
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return fmt.Sprint(entries[i].key) < fmt.Sprint(entries[j].key)
+		})
+
+		return entries, true
+	case reflect.Struct:
+		if !withObjects {
+			return nil, false
+		}
+
+		fields := structFields(obj)
+		entries := make([]entry, len(fields))
+
+		for index, field := range fields {
+			entries[index] = entry{key: field.name, value: interfaceOf(field.value)}
+		}
+
+		return entries, true
+	default:
+		return nil, false
+	}
+}
+
+type structField struct {
+	name  string
+	value reflect.Value
+}
+
+// structFields lists the exported fields of a struct, named after their json or yaml tag like the encoders do.
+// Fields tagged "-" are ignored and the fields of embedded structs without a name are promoted.
+func structFields(obj reflect.Value) []structField {
+	fields := []structField{}
+
+	for index := 0; index < obj.NumField(); index++ {
+		field := obj.Type().Field(index)
+
+		name, tagged := fieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && !tagged {
+			if embedded := indirect(obj.Field(index)); embedded.Kind() == reflect.Struct {
+				fields = append(fields, structFields(embedded)...)
+
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		fields = append(fields, structField{name: name, value: obj.Field(index)})
+	}
+
+	return fields
+}
+
+// fieldName returns the name of a field given by its json tag, then its yaml tag, then the name of the field.
+func fieldName(field reflect.StructField) (string, bool) {
+	for _, tag := range []string{"json", "yaml"} {
+		if value, ok := field.Tag.Lookup(tag); ok {
+			if name, _, _ := strings.Cut(value, ","); name != "" {
+				return name, true
+			}
+		}
+	}
+
+	return field.Name, false
+}
+
+// visit identifies a pointer, a map or a slice of the context, to detect the values containing themselves.
+type visit struct {
+	ptr    uintptr
+	typ    reflect.Type
+	length int
+}
+
+// identity returns the visit of a value that can contain itself, ok is false for other values.
+func identity(value any) (visit, bool) {
+	obj := reflect.ValueOf(value)
+
+	switch obj.Kind() { //nolint:exhaustive
+	case reflect.Pointer, reflect.Map:
+		if obj.IsNil() {
+			return visit{}, false
+		}
+
+		return visit{ptr: obj.Pointer(), typ: obj.Type(), length: 0}, true
+	case reflect.Slice:
+		if obj.Len() == 0 {
+			return visit{}, false
+		}
+
+		return visit{ptr: obj.Pointer(), typ: obj.Type(), length: obj.Len()}, true
+	default:
+		return visit{}, false
+	}
+}
+
+// converter converts the values of the context to plain maps ([string]any) and slices ([]any) usable by
+// text/template, or to ordered maps if ordered is true. Struct fields are named like in path expressions,
+// values marshaling themselves (time.Time) are kept.
+type converter struct {
+	ordered bool
+	seen    map[visit]struct{} // values being converted, from the root to the current one
+}
+
+func newConverter(ordered bool) converter {
+	return converter{ordered: ordered, seen: map[visit]struct{}{}}
+}
+
+// convert returns the converted value, changed is false if the value is returned as is.
+func (c converter) convert(value any) (any, bool, error) {
+	switch value.(type) {
+	case nil, string, bool, int, int64, float64, []byte, encoding.TextMarshaler, json.Marshaler:
+		return value, false, nil
+	}
+
+	if id, ok := identity(value); ok {
+		if _, exists := c.seen[id]; exists {
+			return nil, false, fmt.Errorf("%w: %T contains itself", ErrCyclicContext, value)
+		}
+
+		c.seen[id] = struct{}{}
+		defer delete(c.seen, id)
+	}
+
+	switch typed := value.(type) {
+	case *OrderedMap:
+		return c.convertOrderedMap(typed)
+	case []any:
+		return c.convertSlice(typed)
+	case map[string]any:
+		return c.convertMap(typed)
+	}
+
+	return c.convertReflect(value)
+}
+
+func (c converter) convertOrderedMap(obj *OrderedMap) (any, bool, error) {
+	if !c.ordered {
+		return obj.Map(), true, nil
+	}
+
+	var result *OrderedMap
+
+	for index, key := range obj.Keys() {
+		item, _ := obj.Get(key)
+
+		converted, changed, err := c.convert(item)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if changed && result == nil {
+			result = NewOrderedMap()
+			for _, previous := range obj.Keys()[:index] {
+				value, _ := obj.Get(previous)
+				result.Set(previous, value)
+			}
+		}
+
+		if result != nil {
+			result.Set(key, converted)
+		}
+	}
+
+	if result == nil {
+		return obj, false, nil
+	}
+
+	return result, true, nil
+}
+
+func (c converter) convertSlice(slice []any) (any, bool, error) {
+	var result []any
+
+	for index, item := range slice {
+		converted, changed, err := c.convert(item)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if changed && result == nil {
+			result = make([]any, len(slice))
+			copy(result, slice)
+		}
+
+		if result != nil {
+			result[index] = converted
+		}
+	}
+
+	if result == nil {
+		return slice, false, nil
+	}
+
+	return result, true, nil
+}
+
+// convertMap converts a plain map, to an ordered map sorted by key if ordered is true, like it is iterated.
+func (c converter) convertMap(obj map[string]any) (any, bool, error) {
+	if c.ordered {
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		return c.object(keys, func(key string) any { return obj[key] })
+	}
+
+	var result map[string]any
+
+	for key, item := range obj {
+		converted, changed, err := c.convert(item)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if changed && result == nil {
+			result = make(map[string]any, len(obj))
+			for key, value := range obj {
+				result[key] = value
+			}
+		}
+
+		if result != nil {
+			result[key] = converted
+		}
+	}
+
+	if result == nil {
+		return obj, false, nil
+	}
+
+	return result, true, nil
+}
+
+// convertReflect converts structs, maps, slices and arrays of any type, and follows pointers.
+func (c converter) convertReflect(value any) (any, bool, error) {
+	obj := indirect(reflect.ValueOf(value))
+
+	switch obj.Kind() { //nolint:exhaustive
+	case reflect.Invalid:
+		return nil, true, nil
+	case reflect.Struct:
+		fields := structFields(obj)
+		keys := make([]string, len(fields))
+		values := make(map[string]any, len(fields))
+
+		for index, field := range fields {
+			keys[index] = field.name
+			values[field.name] = interfaceOf(field.value)
+		}
+
+		return c.object(keys, func(key string) any { return values[key] })
+	case reflect.Map:
+		entries, _ := reflectIterate(value, true)
+		keys := make([]string, len(entries))
+		values := make(map[string]any, len(entries))
+
+		for index, entry := range entries {
+			keys[index] = fmt.Sprint(entry.key)
+			values[keys[index]] = entry.value
+		}
+
+		return c.object(keys, func(key string) any { return values[key] })
+	case reflect.Slice, reflect.Array:
+		result := make([]any, obj.Len())
+
+		for index := range result {
+			converted, _, err := c.convert(interfaceOf(obj.Index(index)))
+			if err != nil {
+				return nil, false, err
+			}
+
+			result[index] = converted
+		}
+
+		return result, true, nil
+	default:
+		if reflect.ValueOf(value).Kind() == reflect.Pointer {
+			return interfaceOf(obj), true, nil
+		}
+
+		return value, false, nil
+	}
+}
+
+// object builds a converted object from its keys, in order.
+func (c converter) object(keys []string, get func(key string) any) (any, bool, error) {
+	ordered := NewOrderedMap()
+	unordered := make(map[string]any, len(keys))
+
+	for _, key := range keys {
+		converted, _, err := c.convert(get(key))
+		if err != nil {
+			return nil, false, err
+		}
+
+		if c.ordered {
+			ordered.Set(key, converted)
+		} else {
+			unordered[key] = converted
+		}
+	}
+
+	if c.ordered {
+		return ordered, true, nil
+	}
+
+	return unordered, true, nil
+}
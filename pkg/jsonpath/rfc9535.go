@@ -0,0 +1,500 @@
+// Copyright (C) 2023 CGI France
+//
+// This file is part of emporte-piece.
+//
+// Emporte-piece is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// Emporte-piece is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with emporte-piece.  If not, see <http://www.gnu.org/licenses/>.
+
+package jsonpath
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxInt is the largest integer allowed in RFC 9535 indexes and slices (2^53-1).
+const maxInt = 1<<53 - 1
+
+// regexpsCapacity bounds the cache of regular expressions, the patterns can be built from the data.
+const regexpsCapacity = 256
+
+// regexps caches the regular expressions of the match and search functions.
+//
+//nolint:gochecknoglobals
+var regexps = newCache[string, *regexp.Regexp](regexpsCapacity)
+
+// CompileRFC9535 parses a JSONPath query of RFC 9535 ($.tables[*].name, $..columns[?@.type == 'date']).
+// The root $ is the context document, at the bottom of the stack, and a query can also start with an alias
+// instead of $ to select values relative to an iteration level (table.columns[0]).
+//
+// Queries are compiled to the same segments as the emporte-piece dialect, so the selected values are pushed
+// on the stack in the same way. Unlike the emporte-piece dialect, a missing key selects nothing.
+func CompileRFC9535(expression string) (*Path, error) {
+	parser := &filterParser{input: []rune(expression), pos: 0, expression: expression, offset: 0, dialect: DialectRFC9535}
+
+	root, err := parser.parseRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := parser.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.pos < len(parser.input) {
+		return nil, parser.errorf("unexpected character %q", parser.input[parser.pos])
+	}
+
+	return &Path{expression: expression, segments: append([]Segment{root}, segments...), dialect: DialectRFC9535}, nil
+}
+
+func (p *filterParser) at(char rune) bool {
+	return p.pos < len(p.input) && p.input[p.pos] == char
+}
+
+// parseRoot reads the root identifier $, or the name of an alias.
+func (p *filterParser) parseRoot() (Segment, error) {
+	if p.at('$') {
+		p.pos++
+
+		return RootSegment{}, nil
+	}
+
+	if p.pos < len(p.input) && isNameFirst(p.input[p.pos]) {
+		return KeySegment{Key: p.parseName()}, nil
+	}
+
+	return nil, p.errorf("a query must start with $ or an alias")
+}
+
+// parseSegments reads the segments of a query, blank spaces are allowed between segments.
+//
+//nolint:cyclop
+func (p *filterParser) parseSegments() ([]Segment, error) {
+	segments := []Segment{}
+
+	for {
+		begin := p.pos
+
+		p.skipSpaces()
+
+		var (
+			segment Segment
+			err     error
+		)
+
+		switch {
+		case p.at('.') && p.pos+1 < len(p.input) && p.input[p.pos+1] == '.':
+			p.pos += 2
+			segments = append(segments, DescentSegment{})
+
+			if p.at('[') {
+				segment, err = p.parseBracketed()
+			} else {
+				segment, err = p.parseShorthand()
+			}
+		case p.at('.'):
+			p.pos++
+			segment, err = p.parseShorthand()
+		case p.at('['):
+			segment, err = p.parseBracketed()
+		default:
+			// the blank spaces belong to the filter around the query
+			p.pos = begin
+
+			return segments, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, segment)
+	}
+}
+
+// parseShorthand reads a wildcard (.*) or a member name (.name) after a dot.
+func (p *filterParser) parseShorthand() (Segment, error) {
+	if p.at('*') {
+		p.pos++
+
+		return WildcardSegment{Objects: true, Keys: false}, nil
+	}
+
+	if p.pos >= len(p.input) || !isNameFirst(p.input[p.pos]) {
+		return nil, p.errorf("invalid member name")
+	}
+
+	return KeySegment{Key: p.parseName()}, nil
+}
+
+func (p *filterParser) parseName() string {
+	begin := p.pos
+
+	for p.pos++; p.pos < len(p.input) && (isNameFirst(p.input[p.pos]) || isDigit(p.input[p.pos])); p.pos++ {
+	}
+
+	return string(p.input[begin:p.pos])
+}
+
+func isNameFirst(char rune) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_' || char >= utf8.RuneSelf
+}
+
+func isDigit(char rune) bool {
+	return char >= '0' && char <= '9'
+}
+
+// parseBracketed reads a bracketed selection, several selectors make a union.
+func (p *filterParser) parseBracketed() (Segment, error) {
+	p.pos++
+
+	selectors := []Segment{}
+
+	for {
+		p.skipSpaces()
+
+		selector, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+
+		selectors = append(selectors, selector)
+
+		p.skipSpaces()
+
+		switch {
+		case p.at(']'):
+			p.pos++
+
+			if len(selectors) == 1 {
+				return selectors[0], nil
+			}
+
+			return UnionSegment{Selectors: selectors}, nil
+		case p.at(','):
+			p.pos++
+		default:
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+}
+
+// parseSelector reads a name ('name'), a wildcard (*), an index (0), a slice (1:3) or a filter (?@.masked).
+func (p *filterParser) parseSelector() (Segment, error) {
+	if p.pos >= len(p.input) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	switch char := p.input[p.pos]; {
+	case char == '\'' || char == '"':
+		key, err := p.parseString()
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+
+		return KeySegment{Key: key}, nil
+	case char == '*':
+		p.pos++
+
+		return WildcardSegment{Objects: true, Keys: false}, nil
+	case char == '?':
+		p.pos++
+		begin := p.pos
+
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		return FilterSegment{Expression: strings.TrimSpace(string(p.input[begin:p.pos])), filter: filter}, nil
+	case char == '-' || char == ':' || isDigit(char):
+		return p.parseIndexOrSlice()
+	default:
+		return nil, p.errorf("unexpected character %q", char)
+	}
+}
+
+func (p *filterParser) parseIndexOrSlice() (Segment, error) {
+	start, err := p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+
+	if !p.at(':') {
+		if start == nil {
+			return nil, p.errorf("expected an index")
+		}
+
+		return IndexSegment{Index: *start}, nil
+	}
+
+	bounds := []*int{start}
+
+	for len(bounds) < 3 && p.at(':') {
+		p.pos++
+		p.skipSpaces()
+
+		bound, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+
+		bounds = append(bounds, bound)
+
+		p.skipSpaces()
+	}
+
+	if len(bounds) < 3 {
+		bounds = append(bounds, nil)
+	}
+
+	return SliceSegment{Start: bounds[0], End: bounds[1], Step: bounds[2]}, nil
+}
+
+// parseInt reads an optional integer, without leading zeros and within the interoperable range of I-JSON.
+func (p *filterParser) parseInt() (*int, error) {
+	begin := p.pos
+
+	if p.at('-') {
+		p.pos++
+	}
+
+	for p.pos < len(p.input) && isDigit(p.input[p.pos]) {
+		p.pos++
+	}
+
+	text := string(p.input[begin:p.pos])
+
+	switch {
+	case text == "":
+		return nil, nil
+	case text == "-" || text == "-0" || (text != "0" && strings.HasPrefix(strings.TrimPrefix(text, "-"), "0")):
+		return nil, p.errorf("invalid integer %s", text)
+	}
+
+	value, err := strconv.Atoi(text)
+	if err != nil || value > maxInt || value < -maxInt {
+		return nil, p.errorf("integer %s out of range", text)
+	}
+
+	return &value, nil
+}
+
+// parseQuery reads a query relative to the current item (@) or to the root ($) in a filter.
+func (p *filterParser) parseQuery() (filterNode, error) {
+	absolute := p.input[p.pos] == '$'
+	p.pos++
+
+	segments, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	return filterCurrent{segments: segments, absolute: absolute, dialect: DialectRFC9535}, nil
+}
+
+// isFunction tells if the parser is on the name of a function, followed by a parenthesis.
+func (p *filterParser) isFunction() bool {
+	index := p.pos
+	for index < len(p.input) && (unicode.IsLower(p.input[index]) || isDigit(p.input[index]) || p.input[index] == '_') {
+		index++
+	}
+
+	return index < len(p.input) && p.input[index] == '('
+}
+
+// parseFunction reads a call to one of the functions of RFC 9535: length, count, match, search and value.
+func (p *filterParser) parseFunction() (filterNode, error) {
+	begin := p.pos
+	name := strings.SplitN(string(p.input[p.pos:]), "(", 2)[0] //nolint:gomnd
+	p.pos += len([]rune(name)) + 1
+
+	args := []filterNode{}
+
+	for !p.consume(")") {
+		if len(args) > 0 && !p.consume(",") {
+			return nil, p.errorf("expected , or )")
+		}
+
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+	}
+
+	function := filterFunction{name: name, args: args}
+	if message := function.check(); message != "" {
+		p.pos = begin
+
+		return nil, p.errorf("%s", message)
+	}
+
+	return function, nil
+}
+
+// filterFunction is a call to a function of RFC 9535 in a filter.
+type filterFunction struct {
+	name string
+	args []filterNode
+}
+
+// check verifies the number and the types of the arguments, it returns an error message if they are invalid.
+func (n filterFunction) check() string {
+	queries := map[string]bool{"count": true, "value": true}
+	arity := map[string]int{"length": 1, "count": 1, "value": 1, "match": 2, "search": 2} //nolint:gomnd
+
+	expected, ok := arity[n.name]
+
+	switch {
+	case !ok:
+		return "unknown function " + n.name
+	case len(n.args) != expected:
+		return "wrong number of arguments for " + n.name
+	}
+
+	for _, arg := range n.args {
+		if _, isQuery := arg.(filterCurrent); queries[n.name] && !isQuery {
+			return "the argument of " + n.name + " must be a query"
+		} else if !queries[n.name] && !isComparable(arg) {
+			return "the arguments of " + n.name + " must be values"
+		}
+	}
+
+	return ""
+}
+
+func (n filterFunction) evaluate(item any, root any) filterValue {
+	nothing := filterValue{value: nil, exists: false}
+
+	switch n.name {
+	case "length":
+		return length(n.args[0].evaluate(item, root))
+	case "count":
+		return filterValue{value: len(n.args[0].(filterCurrent).nodes(item, root)), exists: true} //nolint:forcetypeassert
+	case "value":
+		if nodes := n.args[0].(filterCurrent).nodes(item, root); len(nodes) == 1 { //nolint:forcetypeassert
+			return filterValue{value: nodes[0], exists: true}
+		}
+
+		return nothing
+	default:
+		value, isString := n.args[0].evaluate(item, root).value.(string)
+		pattern, isPattern := n.args[1].evaluate(item, root).value.(string)
+
+		if !isString || !isPattern {
+			return filterValue{value: false, exists: true}
+		}
+
+		if n.name == "match" {
+			pattern = "^(?:" + pattern + ")$"
+		}
+
+		re, err := compileRegexp(pattern)
+
+		return filterValue{value: err == nil && re.MatchString(value), exists: true}
+	}
+}
+
+func length(value filterValue) filterValue {
+	if str, ok := value.value.(string); ok {
+		return filterValue{value: utf8.RuneCountInString(str), exists: true}
+	}
+
+	if entries, ok := iterate(value.value, true); ok && value.value != nil {
+		return filterValue{value: len(entries), exists: true}
+	}
+
+	return filterValue{value: nil, exists: false}
+}
+
+// compileRegexp compiles an I-Regexp (RFC 9485), where a dot matches any character except line breaks.
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(pattern); ok {
+		return re, nil
+	}
+
+	translated := strings.Builder{}
+	class := false
+	escaped := false
+
+	for _, char := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '[':
+			class = true
+		case char == ']':
+			class = false
+		case char == '.' && !class:
+			translated.WriteString(`[^\n\r]`)
+
+			continue
+		}
+
+		translated.WriteRune(char)
+	}
+
+	re, err := regexp.Compile(translated.String())
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	regexps.Store(pattern, re)
+
+	return re, nil
+}
+
+// isComparable tells if a node can be compared: a literal, a singular query or a function returning a value.
+func isComparable(node filterNode) bool {
+	switch typed := node.(type) {
+	case filterLiteral:
+		return true
+	case filterFunction:
+		return typed.name != "match" && typed.name != "search"
+	case filterCurrent:
+		for _, segment := range typed.segments {
+			switch segment.(type) {
+			case KeySegment, IndexSegment:
+			default:
+				return false
+			}
+		}
+
+		return true
+	default:
+		return false
+	}
+}
+
+// isTestable tells if a node can be used alone in a filter: a query or a function returning a boolean.
+func isTestable(node filterNode) bool {
+	switch typed := node.(type) {
+	case filterCurrent:
+		return true
+	case filterFunction:
+		return typed.name == "match" || typed.name == "search"
+	default:
+		return false
+	}
+}
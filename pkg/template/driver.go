@@ -19,33 +19,173 @@
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 	"text/template"
 	"unicode"
 
 	"github.com/Masterminds/sprig/v3"
+	"github.com/cgi-fr/emporte-piece/pkg/jsonpath"
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 )
 
+var (
+	ErrUndefinedVar  = errors.New("undefined variable")
+	ErrUndefinedLoop = errors.New("undefined iteration level")
+)
+
 func Generate(tmplstr string, stack []any) ([]byte, error) {
-	funcmap := generateFuncMap()
+	return GenerateScope(tmplstr, jsonpath.Scope{Stack: stack, Vars: nil, Loops: nil})
+}
+
+// GenerateScope renders a template with a scope, variables are available with the Var function
+// and as fields of the data when the root of the stack is an object.
+func GenerateScope(tmplstr string, scope jsonpath.Scope) ([]byte, error) {
+	return NewGenerator().Generate(tmplstr, scope)
+}
+
+// Generator renders templates, in strict mode a missing key is an error instead of <no value>.
+type Generator struct {
+	strict   bool
+	dialect  jsonpath.Dialect
+	partials []Partial
+	left     string
+	right    string
+}
+
+// Partial is a template source parsed along with every template, the templates it defines ({{define "name"}})
+// can be called with the template action or the include function. The source itself is a template named Name,
+// parsed with its own delimiters (the default ones if empty).
+type Partial struct {
+	Name   string
+	Source string
+	Left   string
+	Right  string
+}
+
+func NewGenerator() Generator {
+	return Generator{
+		strict:   false,
+		dialect:  jsonpath.DialectEmportePiece,
+		partials: nil,
+		left:     "",
+		right:    "",
+	}
+}
+
+// WithStrict returns a copy of the generator that fails on missing keys.
+func (g Generator) WithStrict(strict bool) Generator {
+	g.strict = strict
+
+	return g
+}
+
+// WithDialect returns a copy of the generator that parses the paths of the Get and GetAll functions in a dialect.
+func (g Generator) WithDialect(dialect jsonpath.Dialect) Generator {
+	g.dialect = dialect
+
+	return g
+}
+
+// WithPartials returns a copy of the generator that parses the partials along with every template.
+func (g Generator) WithPartials(partials ...Partial) Generator {
+	g.partials = append([]Partial{}, partials...)
+
+	return g
+}
+
+// WithDelims returns a copy of the generator that parses the templates with other action delimiters ([[ .name ]]),
+// an empty delimiter is the default one.
+func (g Generator) WithDelims(left string, right string) Generator {
+	g.left, g.right = left, right
+
+	return g
+}
+
+// Generate renders a template with a scope, like GenerateScope, in the mode of the generator.
+func (g Generator) Generate(tmplstr string, scope jsonpath.Scope) ([]byte, error) {
+	stack := scope.Stack
+	funcmap := FuncMap()
+	developer := jsonpath.NewDeveloper().WithStrict(g.strict).WithDialect(g.dialect)
 
 	funcmap["Stack"] = generateStackFunc(stack)
+	funcmap["Get"] = generateGetFunc(developer, scope)
+	funcmap["GetAll"] = generateGetAllFunc(developer, scope)
+	funcmap["Var"] = generateVarFunc(scope.Vars)
+	funcmap["Loop"] = generateLoopFunc(scope.Loops)
+
+	missingkey := "missingkey=default"
+	if g.strict {
+		missingkey = "missingkey=error"
+	}
+
+	tmpl := template.New("template")
+	funcmap["include"] = generateIncludeFunc(tmpl)
+	tmpl = tmpl.Funcs(funcmap).Option(missingkey)
 
-	tmpl, err := template.New("template").Funcs(sprig.TxtFuncMap()).Funcs(funcmap).Parse(tmplstr)
+	for _, partial := range g.partials {
+		if _, err := tmpl.New(partial.Name).Delims(partial.Left, partial.Right).Parse(partial.Source); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+	}
+
+	tmpl, err := tmpl.Delims(g.left, g.right).Parse(tmplstr)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	data, err := generateData(scope)
 	if err != nil {
 		return nil, fmt.Errorf("%w", err)
 	}
 
 	result := &bytes.Buffer{}
-	err = tmpl.Execute(result, stack[0])
+	err = tmpl.Execute(result, data)
 
 	return result.Bytes(), err
 }
 
+// generateData returns the root of the stack, with the variables added if it is an object.
+// The ordered maps of a normalized context are converted once, the conversion is cached.
+func generateData(scope jsonpath.Scope) (any, error) {
+	data, err := jsonpath.Plain(scope.Stack[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	root, ok := data.(map[string]any)
+	if !ok || len(scope.Vars) == 0 {
+		return data, nil
+	}
+
+	result := make(map[string]any, len(root)+len(scope.Vars))
+	for key, value := range root {
+		result[key] = value
+	}
+
+	for name, value := range scope.Vars {
+		if result[name], err = jsonpath.Plain(value); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// FuncMap returns the functions available in templates that do not depend on the stack, sprig functions included.
+func FuncMap() template.FuncMap {
+	funcMap := sprig.TxtFuncMap()
+
+	for name, fn := range generateFuncMap() {
+		funcMap[name] = fn
+	}
+
+	return funcMap
+}
+
 func generateFuncMap() template.FuncMap {
 	funcMap := template.FuncMap{}
 
@@ -56,16 +196,92 @@ funcMap["NoAccent"] = rmAcc
 	return funcMap
 }
 
-func generateStackFunc(stack []any) func(index int) any {
-	return func(index int) any {
+// generateStackFunc returns an item of the stack, converted when it is used so that templates can access its keys.
+func generateStackFunc(stack []any) func(index int) (any, error) {
+	return func(index int) (any, error) {
 		if index < 0 {
-			return stack[len(stack)+index]
+			return jsonpath.Plain(stack[len(stack)+index]) //nolint:wrapcheck
 		}
 
-		return stack[index]
+		return jsonpath.Plain(stack[index]) //nolint:wrapcheck
 	}
 }
 
+// generateGetFunc returns the first value selected by a path expression evaluated on the stack.
+func generateGetFunc(developer jsonpath.Developer, scope jsonpath.Scope) func(path string) (any, error) {
+	return func(path string) (any, error) {
+		results, err := developer.Get(path, scope)
+		if err != nil || len(results) == 0 {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return jsonpath.Plain(results[0].Selected) //nolint:wrapcheck
+	}
+}
+
+// generateGetAllFunc returns all the values selected by a path expression evaluated on the stack.
+func generateGetAllFunc(developer jsonpath.Developer, scope jsonpath.Scope) func(path string) ([]any, error) {
+	return func(path string) ([]any, error) {
+		results, err := developer.Get(path, scope)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		values := make([]any, len(results))
+		for i, result := range results {
+			if values[i], err = jsonpath.Plain(result.Selected); err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+		}
+
+		return values, nil
+	}
+}
+
+// generateIncludeFunc returns the result of a named template as a string, so that it can be used in a pipeline.
+func generateIncludeFunc(tmpl *template.Template) func(name string, data any) (string, error) {
+	return func(name string, data any) (string, error) {
+		result := &strings.Builder{}
+		if err := tmpl.ExecuteTemplate(result, name, data); err != nil {
+			return "", fmt.Errorf("%w", err)
+		}
+
+		return result.String(), nil
+	}
+}
+
+// generateVarFunc returns the value bound to an alias.
+func generateVarFunc(vars map[string]any) func(name string) (any, error) {
+	return func(name string) (any, error) {
+		value, ok := vars[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUndefinedVar, name)
+		}
+
+		return jsonpath.Plain(value) //nolint:wrapcheck
+	}
+}
+
+// generateLoopFunc returns the metadata of an iteration level, negative indexes start from the innermost level.
+func generateLoopFunc(loops []jsonpath.Loop) func(index int) (jsonpath.Loop, error) {
+	return func(index int) (jsonpath.Loop, error) {
+		if index < 0 {
+			index += len(loops)
+		}
+
+		if index < 0 || index >= len(loops) {
+			return jsonpath.Loop{}, fmt.Errorf("%w: %d", ErrUndefinedLoop, index) //nolint:exhaustruct
+		}
+
+		return loops[index], nil
+	}
+}
+
+// RemoveAccents removes accents from a string, like the NoAccent function of templates.
+func RemoveAccents(s string) string {
+	return rmAcc(s)
+}
+
 // rmAcc removes accents from string
 // Function derived from: http://blog.golang.org/normalization
 func rmAcc(s string) string {